@@ -0,0 +1,418 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"iter"
+	"net"
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/samber/lo"
+)
+
+const maxHostBits = 16
+
+// EnumOptions controls which addresses of a network are enumerated besides the
+// usable host range.
+type EnumOptions struct {
+	IncludeNetwork   bool
+	IncludeBroadcast bool
+}
+
+type target struct {
+	IP     net.IP
+	Blocks []string
+}
+
+// hostSet is the union of the hosts of several pools, without the excluded
+// ones. Its addresses are produced on demand rather than kept in memory, so
+// the size of the pools does not matter.
+type hostSet struct {
+	blocks   []string
+	ranges   []hostRange
+	excluded []*net.IPNet
+}
+
+// enumerate parses the given CIDRs into the set of their hosts.
+func enumerate(cidrs []string, opts EnumOptions) (*hostSet, error) {
+	set := &hostSet{}
+	for _, cidr := range cidrs {
+		network, err := parseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid address: %s", cidr)
+		}
+
+		r, err := hosts(network, opts)
+		if err != nil {
+			return nil, err
+		}
+		set.blocks = append(set.blocks, network.String())
+		set.ranges = append(set.ranges, r)
+	}
+	return set, nil
+}
+
+// exclude leaves out the addresses that belong to any of the given CIDRs.
+func (s *hostSet) exclude(cidrs []string) error {
+	for _, cidr := range cidrs {
+		network, err := parseCIDR(cidr)
+		if err != nil {
+			return fmt.Errorf("Invalid exclusion: %s", cidr)
+		}
+		s.excluded = append(s.excluded, network)
+	}
+	return nil
+}
+
+// All yields every host once, in the order of the pools, together with every
+// block it belongs to.
+func (s *hostSet) All() iter.Seq[target] {
+	return func(yield func(target) bool) {
+		for t, excluded := range s.union() {
+			if !excluded && !yield(t) {
+				return
+			}
+		}
+	}
+}
+
+// Count returns the number of hosts in the set and the number left out by
+// exclude.
+func (s *hostSet) Count() (hosts, excluded int) {
+	for _, isExcluded := range s.union() {
+		if isExcluded {
+			excluded++
+		} else {
+			hosts++
+		}
+	}
+	return hosts, excluded
+}
+
+// union yields the hosts of all pools, each at the first pool that has it,
+// and whether it is excluded.
+func (s *hostSet) union() iter.Seq2[target, bool] {
+	return func(yield func(target, bool) bool) {
+		for i, r := range s.ranges {
+			for ip := range r.All() {
+				if slices.ContainsFunc(s.ranges[:i], func(r hostRange) bool { return r.Contains(ip) }) {
+					continue
+				}
+				t := target{IP: ip, Blocks: []string{s.blocks[i]}}
+				for j := i + 1; j < len(s.ranges); j++ {
+					if s.ranges[j].Contains(ip) && !lo.Contains(t.Blocks, s.blocks[j]) {
+						t.Blocks = append(t.Blocks, s.blocks[j])
+					}
+				}
+				excluded := lo.ContainsBy(s.excluded, func(network *net.IPNet) bool { return network.Contains(ip) })
+				if !yield(t, excluded) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// SubnetInfo describes a network as parsed from its CIDR.
+type SubnetInfo struct {
+	Network   net.IP
+	Prefix    int
+	Netmask   net.IP
+	Broadcast net.IP // nil for IPv6
+	FirstHost net.IP
+	LastHost  net.IP
+	Hosts     int
+}
+
+// subnetInfo returns the details of the network of cidr. The host range is the
+// one that is scanned by default.
+func subnetInfo(cidr string) (SubnetInfo, error) {
+	network, err := parseCIDR(cidr)
+	if err != nil {
+		return SubnetInfo{}, fmt.Errorf("Invalid address: %s", cidr)
+	}
+
+	ones, bits := network.Mask.Size()
+	info := SubnetInfo{
+		Network: network.IP,
+		Prefix:  ones,
+		Netmask: net.IP(network.Mask),
+	}
+	if bits == 8*net.IPv4len {
+		info.Broadcast = make(net.IP, len(network.IP))
+		for i := range network.IP {
+			info.Broadcast[i] = network.IP[i] | ^network.Mask[i]
+		}
+	}
+
+	r, err := hosts(network, EnumOptions{})
+	if err != nil {
+		return SubnetInfo{}, err
+	}
+	info.Hosts = r.Count
+	if r.Count > 0 {
+		info.FirstHost, info.LastHost = r.First, r.Last
+	}
+	return info, nil
+}
+
+// prioritize moves the addresses most likely to be gateways to the front:
+// the first and last host of every block and IPv4 addresses ending in .1 or
+// .254. The order is otherwise kept. addresses is iterated once to find the
+// first and last hosts and twice more to yield them.
+func prioritize(addresses iter.Seq[target]) iter.Seq[target] {
+	return func(yield func(target) bool) {
+		first, last := make(map[string]net.IP), make(map[string]net.IP)
+		for t := range addresses {
+			for _, block := range t.Blocks {
+				if ip, ok := first[block]; !ok || compareIPs(t.IP, ip) < 0 {
+					first[block] = t.IP
+				}
+				if ip, ok := last[block]; !ok || compareIPs(t.IP, ip) > 0 {
+					last[block] = t.IP
+				}
+			}
+		}
+		important := func(t target) bool {
+			if ip4 := t.IP.To4(); ip4 != nil && (ip4[3] == 1 || ip4[3] == 254) {
+				return true
+			}
+			return lo.SomeBy(t.Blocks, func(block string) bool {
+				return first[block].Equal(t.IP) || last[block].Equal(t.IP)
+			})
+		}
+
+		for _, wanted := range []bool{true, false} {
+			for t := range addresses {
+				if important(t) == wanted && !yield(t) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// readTargets reads targets from r, one or more per line. Empty lines and
+// lines starting with # are skipped.
+func readTargets(r io.Reader) ([]string, error) {
+	var targets []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		targets = append(targets, parseTargets(line)...)
+	}
+	return targets, scanner.Err()
+}
+
+// canonicalBlocks returns the networks of the given CIDRs in the form Result
+// records them, without duplicates and in the order given. Invalid CIDRs are
+// skipped.
+func canonicalBlocks(cidrs []string) []string {
+	var blocks []string
+	for _, cidr := range cidrs {
+		network, err := parseCIDR(cidr)
+		if err != nil {
+			continue
+		}
+		if block := network.String(); !lo.Contains(blocks, block) {
+			blocks = append(blocks, block)
+		}
+	}
+	return blocks
+}
+
+// parseCIDR parses an address pool in CIDR notation. A bare IP is a pool of
+// just that address, as if /32 or /128 were given. IPv4-mapped IPv6 pools
+// such as ::ffff:10.0.0.0/120 are IPv4 pools, here 10.0.0.0/24.
+func parseCIDR(cidr string) (*net.IPNet, error) {
+	if ip := net.ParseIP(cidr); ip != nil {
+		if v4 := ip.To4(); v4 != nil {
+			return &net.IPNet{IP: v4, Mask: net.CIDRMask(32, 32)}, nil
+		}
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}, nil
+	}
+	_, network, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return nil, err
+	}
+	const mappedPrefix = 8 * (net.IPv6len - net.IPv4len)
+	if ones, bits := network.Mask.Size(); bits == 8*net.IPv6len && ones >= mappedPrefix {
+		if v4 := network.IP.To4(); v4 != nil {
+			return &net.IPNet{IP: v4, Mask: net.CIDRMask(ones-mappedPrefix, 8*net.IPv4len)}, nil
+		}
+	}
+	return network, nil
+}
+
+func parseTargets(s string) []string {
+	return strings.FieldsFunc(s, func(r rune) bool {
+		return r == ',' || unicode.IsSpace(r)
+	})
+}
+
+// hostRange is a run of consecutive addresses.
+type hostRange struct {
+	First, Last net.IP
+	Count       int
+}
+
+// All yields the addresses of the range in ascending order.
+func (r hostRange) All() iter.Seq[net.IP] {
+	return func(yield func(net.IP) bool) {
+		current := r.First
+		for i := 0; i < r.Count; i++ {
+			if !yield(current) {
+				return
+			}
+			current = nextIP(current)
+		}
+	}
+}
+
+// Contains reports whether ip is one of the addresses of the range.
+func (r hostRange) Contains(ip net.IP) bool {
+	return r.Count > 0 && compareIPs(r.First, ip) <= 0 && compareIPs(ip, r.Last) <= 0
+}
+
+// hosts returns the usable host addresses of the network: everything but the
+// network and broadcast addresses for IPv4 and everything but the
+// subnet-router anycast address for IPv6. opts can add those addresses back.
+func hosts(network *net.IPNet, opts EnumOptions) (hostRange, error) {
+	ones, bits := network.Mask.Size()
+	hostBits := bits - ones
+	if hostBits > maxHostBits {
+		return hostRange{}, fmt.Errorf("Address pool %s is too large: at most /%d is supported", network, bits-maxHostBits)
+	}
+
+	first := network.IP.Mask(network.Mask)
+	total := 1 << hostBits
+
+	skipFirst, skipLast := total > 2, bits == 8*net.IPv4len && total > 2
+	if bits == 8*net.IPv6len {
+		skipFirst, skipLast = total > 1, false
+	}
+	skipFirst = skipFirst && !opts.IncludeNetwork
+	skipLast = skipLast && !opts.IncludeBroadcast
+
+	r := hostRange{First: first, Count: total}
+	if skipFirst {
+		r.First, r.Count = nextIP(first), r.Count-1
+	}
+	if skipLast {
+		r.Count--
+	}
+	r.Last = addIP(r.First, r.Count-1)
+	return r, nil
+}
+
+// addIP returns the address n after ip.
+func addIP(ip net.IP, n int) net.IP {
+	sum := make(net.IP, len(ip))
+	copy(sum, ip)
+	for i := len(sum) - 1; i >= 0 && n > 0; i-- {
+		n += int(sum[i])
+		sum[i], n = byte(n), n>>8
+	}
+	return sum
+}
+
+func nextIP(ip net.IP) net.IP {
+	next := make(net.IP, len(ip))
+	copy(next, ip)
+	for i := len(next) - 1; i >= 0; i-- {
+		next[i]++
+		if next[i] != 0 {
+			break
+		}
+	}
+	return next
+}
+
+// compareIPs orders IPv4 addresses before IPv6 ones and compares addresses of
+// the same family numerically, whichever length their net.IP happens to have.
+func compareIPs(a, b net.IP) int {
+	a4, b4 := a.To4(), b.To4()
+	switch {
+	case a4 != nil && b4 != nil:
+		return bytes.Compare(a4, b4)
+	case a4 != nil:
+		return -1
+	case b4 != nil:
+		return 1
+	default:
+		return bytes.Compare(a.To16(), b.To16())
+	}
+}
+
+// localSubnet is an IPv4 network one of the interfaces is attached to.
+type localSubnet struct {
+	Interface string
+	CIDR      string
+}
+
+// localSubnets returns the IPv4 networks of all interfaces that are up, except
+// loopback ones.
+func localSubnets() ([]localSubnet, error) {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil, fmt.Errorf("Unable to list interfaces: %w", err)
+	}
+
+	var subnets []localSubnet
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			logger.Debug("reading interface addresses failed", "iface", iface.Name, "err", err)
+			continue
+		}
+		for _, addr := range addrs {
+			ipNet, ok := addr.(*net.IPNet)
+			if !ok || ipNet.IP.To4() == nil {
+				continue
+			}
+			network := &net.IPNet{IP: ipNet.IP.Mask(ipNet.Mask), Mask: ipNet.Mask}
+			subnet := localSubnet{Interface: iface.Name, CIDR: network.String()}
+			if !lo.Contains(subnets, subnet) {
+				subnets = append(subnets, subnet)
+			}
+		}
+	}
+	return subnets, nil
+}
+
+// interfaceAddress returns the first IPv4 or IPv6 address of the named
+// interface.
+func interfaceAddress(name string, v4 bool) (net.IP, error) {
+	iface, err := net.InterfaceByName(name)
+	if err != nil {
+		return nil, fmt.Errorf("Unknown interface: %s", name)
+	}
+
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read addresses of interface %s: %w", name, err)
+	}
+
+	for _, addr := range addrs {
+		ipNet, ok := addr.(*net.IPNet)
+		if !ok {
+			continue
+		}
+		if (ipNet.IP.To4() != nil) == v4 {
+			return ipNet.IP, nil
+		}
+	}
+
+	family := lo.If(v4, "IPv4").Else("IPv6")
+	return nil, fmt.Errorf("Interface %s has no %s address", name, family)
+}
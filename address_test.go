@@ -0,0 +1,181 @@
+package main
+
+import (
+	"net"
+	"slices"
+	"testing"
+)
+
+// hostIPs returns the addresses of set as strings, in the order of All.
+func hostIPs(set *hostSet) []string {
+	var ips []string
+	for t := range set.All() {
+		ips = append(ips, t.IP.String())
+	}
+	return ips
+}
+
+func TestHostSetExclude(t *testing.T) {
+	tests := []struct {
+		name     string
+		pools    []string
+		exclude  []string
+		want     []string
+		excluded int
+	}{
+		{
+			name:  "nothing excluded",
+			pools: []string{"10.0.0.0/29"},
+			want:  []string{"10.0.0.1", "10.0.0.2", "10.0.0.3", "10.0.0.4", "10.0.0.5", "10.0.0.6"},
+		},
+		{
+			name:     "single hosts",
+			pools:    []string{"10.0.0.0/29"},
+			exclude:  []string{"10.0.0.2", "10.0.0.5/32"},
+			want:     []string{"10.0.0.1", "10.0.0.3", "10.0.0.4", "10.0.0.6"},
+			excluded: 2,
+		},
+		{
+			name:     "subnet",
+			pools:    []string{"10.0.0.0/29"},
+			exclude:  []string{"10.0.0.4/30"},
+			want:     []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"},
+			excluded: 3,
+		},
+		{
+			name:     "everything",
+			pools:    []string{"10.0.0.0/30"},
+			exclude:  []string{"10.0.0.0/24"},
+			excluded: 2,
+		},
+		{
+			name:    "outside the pool",
+			pools:   []string{"10.0.0.0/30"},
+			exclude: []string{"10.0.1.1", "fd00::1"},
+			want:    []string{"10.0.0.1", "10.0.0.2"},
+		},
+		{
+			name:     "several pools",
+			pools:    []string{"10.0.0.0/30", "fd00::/126"},
+			exclude:  []string{"10.0.0.1", "fd00::2"},
+			want:     []string{"10.0.0.2", "fd00::1", "fd00::3"},
+			excluded: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			set, err := enumerate(tt.pools, EnumOptions{})
+			if err != nil {
+				t.Fatalf("enumerate(%v): %v", tt.pools, err)
+			}
+			if err := set.exclude(tt.exclude); err != nil {
+				t.Fatalf("exclude(%v): %v", tt.exclude, err)
+			}
+			if got := hostIPs(set); !slices.Equal(got, tt.want) {
+				t.Errorf("hosts = %v, want %v", got, tt.want)
+			}
+			if hosts, excluded := set.Count(); hosts != len(tt.want) || excluded != tt.excluded {
+				t.Errorf("Count() = %d, %d, want %d, %d", hosts, excluded, len(tt.want), tt.excluded)
+			}
+		})
+	}
+}
+
+func TestHostSetExcludeInvalid(t *testing.T) {
+	set, err := enumerate([]string{"10.0.0.0/30"}, EnumOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := set.exclude([]string{"10.0.0.300"}); err == nil {
+		t.Error("exclude accepted an invalid address")
+	}
+}
+
+func TestIPv4MappedAddresses(t *testing.T) {
+	tests := []struct {
+		name     string
+		pools    []string
+		exclude  []string
+		want     []string
+		excluded int
+	}{
+		{
+			name:  "mapped pool is the IPv4 pool",
+			pools: []string{"::ffff:10.0.0.0/126"},
+			want:  []string{"10.0.0.1", "10.0.0.2"},
+		},
+		{
+			name:  "both forms count once",
+			pools: []string{"10.0.0.0/30", "::ffff:10.0.0.0/126", "::ffff:10.0.0.2"},
+			want:  []string{"10.0.0.1", "10.0.0.2"},
+		},
+		{
+			name:     "mapped exclusion",
+			pools:    []string{"10.0.0.0/29"},
+			exclude:  []string{"::ffff:10.0.0.1", "::ffff:10.0.0.4/127"},
+			want:     []string{"10.0.0.2", "10.0.0.3", "10.0.0.6"},
+			excluded: 3,
+		},
+		{
+			name:     "IPv4 exclusion of a mapped pool",
+			pools:    []string{"::ffff:10.0.0.0/125"},
+			exclude:  []string{"10.0.0.6"},
+			want:     []string{"10.0.0.1", "10.0.0.2", "10.0.0.3", "10.0.0.4", "10.0.0.5"},
+			excluded: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			set, err := enumerate(tt.pools, EnumOptions{})
+			if err != nil {
+				t.Fatalf("enumerate(%v): %v", tt.pools, err)
+			}
+			if err := set.exclude(tt.exclude); err != nil {
+				t.Fatalf("exclude(%v): %v", tt.exclude, err)
+			}
+			if got := hostIPs(set); !slices.Equal(got, tt.want) {
+				t.Errorf("hosts = %v, want %v", got, tt.want)
+			}
+			if hosts, excluded := set.Count(); hosts != len(tt.want) || excluded != tt.excluded {
+				t.Errorf("Count() = %d, %d, want %d, %d", hosts, excluded, len(tt.want), tt.excluded)
+			}
+		})
+	}
+}
+
+func TestCompareIPsMixedForms(t *testing.T) {
+	tests := []struct {
+		a, b net.IP
+		want int
+	}{
+		{net.ParseIP("10.0.0.1").To4(), net.ParseIP("10.0.0.1").To16(), 0},
+		{net.ParseIP("10.0.0.1").To16(), net.ParseIP("10.0.0.2").To4(), -1},
+		{net.ParseIP("10.0.0.10").To4(), net.ParseIP("10.0.0.9").To16(), 1},
+		{net.ParseIP("255.255.255.255").To16(), net.ParseIP("::1"), -1},
+		{net.ParseIP("::1"), net.ParseIP("0.0.0.1").To4(), 1},
+	}
+	for _, tt := range tests {
+		if got := compareIPs(tt.a, tt.b); got != tt.want {
+			t.Errorf("compareIPs(%v (%d bytes), %v (%d bytes)) = %d, want %d", tt.a, len(tt.a), tt.b, len(tt.b), got, tt.want)
+		}
+	}
+}
+
+func TestSortResultsMixedForms(t *testing.T) {
+	results := []Result{
+		{IP: net.ParseIP("10.0.0.10").To16()},
+		{IP: net.ParseIP("fd00::1")},
+		{IP: net.ParseIP("10.0.0.2").To4()},
+		{IP: net.ParseIP("10.0.0.9").To16()},
+		{IP: net.ParseIP("10.0.0.1").To4()},
+	}
+	sortResults(results, "ip")
+	var got []string
+	for _, result := range results {
+		got = append(got, result.IP.String())
+	}
+	want := []string{"10.0.0.1", "10.0.0.2", "10.0.0.9", "10.0.0.10", "fd00::1"}
+	if !slices.Equal(got, want) {
+		t.Errorf("sortResults = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"math/big"
+	"net"
+	"slices"
+)
+
+// aggregate returns the smallest set of CIDR blocks that covers exactly the
+// given addresses, IPv4 blocks first.
+func aggregate(ips []net.IP) []*net.IPNet {
+	sorted := slices.Clone(ips)
+	slices.SortFunc(sorted, compareIPs)
+	sorted = slices.CompactFunc(sorted, func(a, b net.IP) bool { return a.Equal(b) })
+
+	var blocks []*net.IPNet
+	for i := 0; i < len(sorted); {
+		start := normalizeIP(sorted[i])
+		end := start
+		for i++; i < len(sorted) && normalizeIP(sorted[i]).Equal(nextIP(end)); i++ {
+			end = normalizeIP(sorted[i])
+		}
+		blocks = append(blocks, rangeToCIDRs(start, end)...)
+	}
+	return blocks
+}
+
+// normalizeIP returns IPv4 addresses in their 4-byte form so that the address
+// length gives the family.
+func normalizeIP(ip net.IP) net.IP {
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4
+	}
+	return ip.To16()
+}
+
+// rangeToCIDRs splits the range from start to end, inclusive, into the largest
+// aligned blocks that fit.
+func rangeToCIDRs(start, end net.IP) []*net.IPNet {
+	bits := 8 * len(start)
+	first := new(big.Int).SetBytes(start)
+	last := new(big.Int).SetBytes(end)
+
+	var blocks []*net.IPNet
+	for first.Cmp(last) <= 0 {
+		hostBits := bits
+		if first.Sign() != 0 {
+			hostBits = int(first.TrailingZeroBits())
+		}
+		for hostBits > 0 {
+			size := new(big.Int).Lsh(big.NewInt(1), uint(hostBits))
+			blockEnd := size.Add(size, first).Sub(size, big.NewInt(1))
+			if blockEnd.Cmp(last) <= 0 {
+				break
+			}
+			hostBits--
+		}
+
+		ip := net.IP(first.FillBytes(make([]byte, len(start))))
+		blocks = append(blocks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits-hostBits, bits)})
+		first.Add(first, new(big.Int).Lsh(big.NewInt(1), uint(hostBits)))
+	}
+	return blocks
+}
@@ -0,0 +1,1018 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"iter"
+	"math"
+	"math/rand"
+	"net"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/go-ping/ping"
+	"github.com/samber/lo"
+)
+
+type Result struct {
+	IP       net.IP
+	Blocks   []string
+	Used     bool
+	RTT      time.Duration
+	Hostname string
+	MACs     []net.HardwareAddr
+	Err      error
+
+	// TTL is the highest time to live of the echo replies, 0 if unknown.
+	TTL int
+
+	// Lease is the lease state of the address when a lease file was given:
+	// leased, stale, rogue or empty.
+	Lease string
+
+	// Cached is set if the host was not probed because it answered a
+	// recent scan, see Options.Cache.
+	Cached bool
+
+	// Confidence is the share of probes that were answered, from 0 for a
+	// free host to 1 for a host that answered every probe.
+	Confidence float64
+
+	// RTTs are the round-trip times of every reply, in the order they came.
+	RTTs []time.Duration
+
+	// Jitter is the standard deviation of RTTs, 0 with fewer than two
+	// replies.
+	Jitter time.Duration
+
+	// Methods are the probe methods the host answered, such as icmp and tcp.
+	Methods []string
+
+	// SNMP is what the host told about itself over SNMP, see
+	// Options.SNMPCommunity.
+	SNMP SNMPInfo
+
+	// Services are the open TCP ports of the host, see Options.TCPPorts.
+	Services []Service
+
+	// Changed is set with -every if the host went from used to free or
+	// back since the scan before.
+	Changed bool
+
+	// Ports maps every TCP port probed to portOpen, portClosed or
+	// portFiltered, see Options.TCPPorts.
+	Ports map[int]string
+
+	// Woke is set if the host only answered the second pass after
+	// Options.Warmup.
+	Woke bool
+
+	// Note is what the user wrote about the address, see Options.Notes.
+	Note string
+
+	// Interfaces tells for every interface whether the host answered on it,
+	// see Options.Interfaces.
+	Interfaces map[string]bool
+}
+
+// OSGuess maps the TTL of the replies to the operating system family that
+// uses the next higher initial TTL. It is a rough heuristic and empty when
+// the TTL is unknown.
+func (r Result) OSGuess() string {
+	switch {
+	case r.TTL <= 0:
+		return ""
+	case r.TTL <= 64:
+		return "Linux/Unix"
+	case r.TTL <= 128:
+		return "Windows"
+	default:
+		return "Network device"
+	}
+}
+
+// Status says whether an address is used, free or unknown.
+type Status int
+
+const (
+	StatusFree Status = iota
+	StatusUsed
+	// StatusUnknown is the status of addresses whose probe failed or that
+	// were not probed at all, so nothing is known about them.
+	StatusUnknown
+)
+
+func (s Status) String() string {
+	return [...]string{"free", "used", "unknown"}[s]
+}
+
+// Status returns the status of the address: used if it answered, unknown if
+// its probe failed and free otherwise.
+func (r Result) Status() Status {
+	switch {
+	case r.Used:
+		return StatusUsed
+	case r.Err != nil:
+		return StatusUnknown
+	default:
+		return StatusFree
+	}
+}
+
+// Mismatch reports whether the host answered on some interfaces but not on
+// others.
+func (r Result) Mismatch() bool {
+	answered := answeredOn(r)
+	return len(answered) > 0 && len(answered) < len(r.Interfaces)
+}
+
+// Conflict reports whether more than one device answered for the address.
+func (r Result) Conflict() bool {
+	return len(r.MACs) > 1
+}
+
+type ScanMeta struct {
+	Started   time.Time
+	Finished  time.Time
+	Duration  time.Duration
+	CIDR      string
+	HostCount int
+	Excluded  int
+
+	// NotScanned counts the addresses left out because the deadline of the
+	// scan passed, see Options.Deadline, or because it was interrupted.
+	NotScanned int
+
+	// Interrupted is set if Analyzer.Stop ended the scan early.
+	Interrupted bool
+
+	// PacketsSent counts the probes sent, retries included. BytesSent
+	// estimates their size on the wire as echo requests of Options.Size.
+	// Both stay zero with Options.Pinger, which may not send anything.
+	PacketsSent int64
+	BytesSent   int64
+
+	// Workers is the number of workers Options.AutoWorkers settled on, zero
+	// without it.
+	Workers int
+}
+
+type Options struct {
+	Size      int
+	Timeout   time.Duration
+	Interface string
+	ARP       bool
+	Workers   int
+	Count     int
+	Resolve   bool
+	Enum      EnumOptions
+
+	// Interval is the time between the echo requests to a host. At zero
+	// they are all sent at once.
+	Interval time.Duration
+
+	// ND probes IPv6 addresses on the links of the interfaces with neighbor
+	// solicitations instead, which also records their MAC addresses. Other
+	// addresses are probed as usual.
+	ND bool
+
+	// Interfaces, when it has more than one name, pings every host from
+	// each of these interfaces at the same time instead of from Interface.
+	Interfaces []string
+
+	// DNSServer, when set, is asked for the hostnames instead of the
+	// system resolver, as host:port. Once it cannot be reached the system
+	// resolver takes over.
+	DNSServer string
+	// DNSTimeout limits every reverse lookup, defaultDNSTimeout if zero.
+	DNSTimeout time.Duration
+
+	// MDNS and NetBIOS ask used hosts for their name over mDNS or NetBIOS
+	// when there is none yet, in this order.
+	MDNS    bool
+	NetBIOS bool
+
+	// SNMPCommunity, when set, fetches sysName and sysDescr of used hosts.
+	// The sysName also names hosts that have no name yet.
+	SNMPCommunity string
+
+	// Exclude lists CIDRs whose addresses are not probed.
+	Exclude []string
+
+	// Cache, when not nil, skips the hosts that answered within its TTL.
+	Cache *resultCache
+
+	// Compare holds the MAC addresses per IP seen by another scan. They are
+	// added to the MACs of used hosts, so a different device makes a conflict.
+	Compare map[string][]net.HardwareAddr
+
+	// Leases, when not nil, are compared with the results to set Result.Lease.
+	Leases map[string]Lease
+
+	// Notes, when not nil, set Result.Note.
+	Notes *noteStore
+
+	// ICMPMode picks raw or unprivileged ICMP sockets for echo requests. The
+	// default, auto, prefers raw sockets and falls back to unprivileged ones.
+	ICMPMode string
+
+	// UDPPort switches from ICMP echo requests to UDP probes of this port.
+	UDPPort int
+
+	// TCPPorts switches from ICMP echo requests to TCP connects to these
+	// ports. Banner also reads what the open ones say first.
+	TCPPorts []int
+	Banner   bool
+
+	// MaxLoss, when positive, is the share of probes from 0 to 1 a host may
+	// lose and still count as used. Hosts that lose more, but not all, are
+	// reported with errPacketLoss instead.
+	MaxLoss float64
+
+	// RequireAll, with TCPPorts, only counts a host as used when every
+	// port is open, instead of when any port accepts or refuses.
+	RequireAll bool
+
+	// UnreachableAsFree counts IPs whose network or host cannot be reached
+	// from here as free, instead of unknown with the error.
+	UnreachableAsFree bool
+
+	// WithICMP sends ICMP echo requests along with the UDP or TCP probes.
+	WithICMP bool
+
+	// HostTimeout, when positive, caps the time spent on a single host,
+	// pings and name lookups together. Hosts that take longer are reported
+	// with errHostTimeout instead of as free.
+	HostTimeout time.Duration
+
+	// Warmup, when positive, probes the hosts that did not answer once more
+	// after this delay, in a second pass over all of them, for devices that
+	// only wake up on the first probe. See Result.Woke.
+	Warmup time.Duration
+
+	// Deadline, when positive, caps the duration of a whole scan. Addresses
+	// that are not probed by then are reported with errNotScanned.
+	Deadline time.Duration
+
+	// Adaptive shortens the timeout to a multiple of the median round-trip
+	// time once enough hosts have answered.
+	Adaptive bool
+
+	// Shuffle probes the addresses in random order instead of ascending.
+	// The results are sorted by address either way. Unlike the ascending
+	// order, which is produced as the scan goes, shuffling needs all
+	// addresses in memory.
+	Shuffle bool
+	// ShuffleSeed, when not zero, seeds the random order so that it is the
+	// same in every scan. Otherwise a seed is picked at random and logged.
+	ShuffleSeed int64
+
+	// AutoWorkers starts the scan with few workers and doubles them, up to
+	// Workers, while the probes do not run out of sockets or buffers,
+	// halving them when too many do.
+	AutoWorkers bool
+
+	// FailFast aborts the scan with the error of the first host whose probe
+	// fails, instead of reporting those hosts as unknown.
+	FailFast bool
+
+	// Priority probes likely gateways before the rest of the pool.
+	Priority bool
+
+	// OnResult, when set, is called with every result as soon as it is known,
+	// in the order the probes finish. Calls never overlap.
+	OnResult func(Result)
+
+	// OnScanDone, when set, is called with all results once a scan finishes
+	// without error.
+	OnScanDone func([]Result, ScanMeta)
+
+	// Tracer finds the routes for Analyzer.Trace. It defaults to ICMP echo
+	// requests with an increasing TTL.
+	Tracer Tracer
+
+	// Pinger probes the addresses. It defaults to ICMP echo requests or UDP
+	// probes built from the options above.
+	Pinger Pinger
+
+	// Prober, when set, probes every address in place of Pinger and of what
+	// Analyzer adds to its replies, such as hostnames and MAC addresses.
+	Prober Prober
+}
+
+// Prober finds out on its own whether an address is used. Probe should return
+// once ctx is done, which it is when -host-timeout or the deadline of the scan
+// passes. Scan fills in Result.IP and Result.Blocks and takes an error that is
+// not a setup error as an unknown host, as it does for Pinger.
+type Prober interface {
+	Probe(ctx context.Context, ip net.IP) (Result, error)
+}
+
+type Analyzer struct {
+	mu     sync.RWMutex
+	wg     sync.WaitGroup
+	opts   Options
+	pinger Pinger
+
+	// single sends one echo request per ping, for PingOnce.
+	single Pinger
+	tracer Tracer
+
+	// resolver looks up the hostnames of used hosts.
+	resolver *hostnameResolver
+
+	// done and total count the addresses of the running scan, all blocks
+	// together.
+	done, total atomic.Int64
+
+	// packets and bytes count what the running scan has sent.
+	packets, bytes atomic.Int64
+
+	// tuner limits the workers of the running scan with Options.AutoWorkers.
+	tuner *workerTuner
+
+	pauseMu sync.Mutex
+	resumed chan struct{}
+
+	// stop cancels the running scan; stopped is set once it was called.
+	stop    context.CancelFunc
+	stopped bool
+}
+
+func NewAnalizer(opts Options) *Analyzer {
+	single := opts
+	single.Count = 1
+	tracer := opts.Tracer
+	if tracer == nil {
+		tracer = newICMPTracer(opts)
+	}
+	resolver := newHostnameResolver(opts.DNSServer, cmp.Or(opts.DNSTimeout, defaultDNSTimeout))
+	return &Analyzer{opts: opts, pinger: newPinger(opts), single: newPinger(single), tracer: tracer, resolver: resolver}
+}
+
+func newPinger(opts Options) Pinger {
+	if opts.Pinger != nil {
+		return opts.Pinger
+	}
+	if len(opts.Interfaces) > 1 {
+		return newIfacePinger(opts)
+	}
+
+	var probes []namedPinger
+	switch {
+	case opts.UDPPort != 0:
+		probes = append(probes, namedPinger{methodUDP, newUDPPinger(opts)})
+	case len(opts.TCPPorts) > 0:
+		probes = append(probes, namedPinger{methodTCP, newTCPPinger(opts)})
+	}
+	if len(probes) == 0 || opts.WithICMP {
+		probes = append(probes, namedPinger{methodICMP, newICMPPinger(opts)})
+	}
+	var pinger Pinger = newMultiPinger(probes)
+	if len(probes) == 1 {
+		pinger = probes[0].pinger
+	}
+	if opts.ND {
+		return newNDPinger(opts, pinger)
+	}
+	return pinger
+}
+
+func (a *Analyzer) Scan(targets []string) ([]Result, ScanMeta, error) {
+	meta := ScanMeta{Started: time.Now(), CIDR: strings.Join(targets, ", ")}
+	if len(targets) == 0 {
+		return nil, meta, errors.New("No address pool to analyze")
+	}
+
+	set, err := enumerate(targets, a.opts.Enum)
+	if err != nil {
+		return nil, meta, err
+	}
+	if err := set.exclude(a.opts.Exclude); err != nil {
+		return nil, meta, err
+	}
+	meta.HostCount, meta.Excluded = set.Count()
+	a.total.Store(int64(meta.HostCount))
+	a.done.Store(0)
+	a.packets.Store(0)
+	a.bytes.Store(0)
+	a.tuner = nil
+	if a.opts.AutoWorkers {
+		a.tuner = newWorkerTuner(max(a.opts.Workers, 1))
+	}
+	addresses := set.All()
+	if a.opts.Shuffle {
+		seed := a.opts.ShuffleSeed
+		for seed == 0 {
+			seed = rand.Int63()
+		}
+		logger.Info("shuffling addresses", "seed", seed)
+		shuffled := slices.Collect(addresses)
+		rand.New(rand.NewSource(seed)).Shuffle(len(shuffled), func(i, j int) {
+			shuffled[i], shuffled[j] = shuffled[j], shuffled[i]
+		})
+		addresses = slices.Values(shuffled)
+	}
+	if a.opts.Priority {
+		addresses = prioritize(addresses)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	a.pauseMu.Lock()
+	a.stop, a.stopped = cancel, false
+	a.pauseMu.Unlock()
+	if a.opts.Deadline > 0 {
+		var cancelDeadline context.CancelFunc
+		ctx, cancelDeadline = context.WithTimeout(ctx, a.opts.Deadline)
+		defer cancelDeadline()
+	}
+
+	var (
+		results  []Result
+		timeouts = newTimeoutTracker(a.opts.Timeout, a.opts.Adaptive)
+		// With a warm-up, free hosts are only reported once the second
+		// pass has had its say.
+		held = make(map[string]int)
+	)
+	report := func(result Result) {
+		if a.opts.OnResult != nil {
+			a.opts.OnResult(result)
+		}
+	}
+	left, setupErr := a.sweep(ctx, addresses, timeouts, func(result Result) {
+		if a.opts.Warmup > 0 && result.Status() == StatusFree && !result.Cached {
+			held[result.IP.String()] = len(results)
+		} else {
+			report(result)
+		}
+		results = append(results, result)
+	})
+
+	if setupErr == nil && len(held) > 0 && ctx.Err() == nil {
+		cold := make([]target, 0, len(held))
+		for _, i := range held {
+			cold = append(cold, target{IP: results[i].IP, Blocks: results[i].Blocks})
+		}
+		logger.Info("waiting for hosts to wake up", "hosts", len(cold), "warmup", a.opts.Warmup)
+		select {
+		case <-time.After(a.opts.Warmup):
+		case <-ctx.Done():
+		}
+		a.total.Add(int64(len(cold)))
+		_, setupErr = a.sweep(ctx, slices.Values(cold), timeouts, func(result Result) {
+			i := held[result.IP.String()]
+			// A second pass cut off by the deadline leaves the first result.
+			if errors.Is(result.Err, errNotScanned) {
+				return
+			}
+			result.Woke = result.Used
+			results[i] = result
+			delete(held, result.IP.String())
+			report(result)
+		})
+	}
+	for _, i := range held {
+		report(results[i])
+	}
+
+	for _, address := range left {
+		result := Result{IP: address.IP, Blocks: address.Blocks, Err: errNotScanned, Note: a.opts.Notes.Get(address.IP)}
+		results = append(results, result)
+		report(result)
+	}
+	for _, result := range results {
+		if errors.Is(result.Err, errNotScanned) {
+			meta.NotScanned++
+		}
+	}
+	a.pauseMu.Lock()
+	meta.Interrupted, a.stop = a.stopped, nil
+	a.pauseMu.Unlock()
+	switch {
+	case meta.Interrupted:
+		logger.Warn("scan interrupted", "not_scanned", meta.NotScanned)
+	case meta.NotScanned > 0:
+		logger.Warn("scan deadline passed", "deadline", a.opts.Deadline, "not_scanned", meta.NotScanned)
+	}
+
+	meta.PacketsSent, meta.BytesSent = a.packets.Load(), a.bytes.Load()
+	if meta.Workers = a.tuner.Limit(); meta.Workers > 0 {
+		logger.Info("scan finished with auto workers", "workers", meta.Workers)
+	}
+	meta.Finished = time.Now()
+	meta.Duration = meta.Finished.Sub(meta.Started)
+
+	if setupErr != nil {
+		return nil, meta, fmt.Errorf("Unable to ping: %w", setupErr)
+	}
+
+	if a.opts.Cache != nil {
+		for _, result := range results {
+			a.opts.Cache.Put(result)
+		}
+		if err := a.opts.Cache.Save(); err != nil {
+			logger.Warn("saving cache failed", "err", err)
+		}
+	}
+	if a.opts.OnScanDone != nil {
+		a.opts.OnScanDone(results, meta)
+	}
+
+	return results, meta, nil
+}
+
+// sweep hands addresses to the workers as they are produced until they are
+// all probed or ctx is done, and returns those that were not handed out.
+// onResult is called with every result as soon as it is known; calls never
+// overlap. A setup error, or with Options.FailFast any host error, stops the
+// sweep and is returned.
+func (a *Analyzer) sweep(ctx context.Context, addresses iter.Seq[target], timeouts *timeoutTracker, onResult func(Result)) ([]target, error) {
+	var (
+		setupErr error
+		jobs     = make(chan target)
+	)
+
+	for i := 0; i < max(a.opts.Workers, 1); i++ {
+		a.wg.Add(1)
+		go func() {
+			defer a.wg.Done()
+			for address := range jobs {
+				a.mu.RLock()
+				failed := setupErr != nil
+				a.mu.RUnlock()
+				if failed {
+					continue
+				}
+
+				result, cached := a.cached(address)
+				var err error
+				if !cached {
+					a.tuner.acquire()
+					result, err = a.probeWithin(ctx, address, timeouts)
+					for retries := 0; a.tuner.release(err) && retries < autoWorkersRetries; retries++ {
+						time.Sleep(time.Duration(retries+1) * autoWorkersRetryDelay)
+						a.tuner.acquire()
+						result, err = a.probeWithin(ctx, address, timeouts)
+					}
+				}
+
+				a.mu.Lock()
+				switch {
+				case isSetupError(err):
+					setupErr = cmp.Or(setupErr, err)
+				case a.failsFast(err):
+					setupErr = cmp.Or(setupErr, fmt.Errorf("%s: %w", address.IP, err))
+				default:
+					result.Note = a.opts.Notes.Get(result.IP)
+					onResult(result)
+				}
+				a.mu.Unlock()
+				a.done.Add(1)
+			}
+		}()
+	}
+
+	var left []target
+	for address := range addresses {
+		if ctx.Err() == nil {
+			a.waitWhilePaused(ctx)
+			select {
+			case jobs <- address:
+				continue
+			case <-ctx.Done():
+			}
+		}
+		left = append(left, address)
+	}
+	close(jobs)
+	a.wg.Wait()
+
+	return left, setupErr
+}
+
+// Pause stops handing out new addresses to the workers. Pings that are
+// already in flight finish normally.
+func (a *Analyzer) Pause() {
+	a.pauseMu.Lock()
+	defer a.pauseMu.Unlock()
+	if a.resumed == nil {
+		a.resumed = make(chan struct{})
+	}
+}
+
+func (a *Analyzer) Resume() {
+	a.pauseMu.Lock()
+	defer a.pauseMu.Unlock()
+	if a.resumed != nil {
+		close(a.resumed)
+		a.resumed = nil
+	}
+}
+
+func (a *Analyzer) Paused() bool {
+	a.pauseMu.Lock()
+	defer a.pauseMu.Unlock()
+	return a.resumed != nil
+}
+
+// failsFast reports whether err, the error of a single host, aborts the scan.
+// Hosts left out by the deadline of the scan never do.
+func (a *Analyzer) failsFast(err error) bool {
+	return a.opts.FailFast && err != nil && !errors.Is(err, errNotScanned)
+}
+
+// Stop ends the running scan early, as if its deadline passed: the addresses
+// not probed by then are reported with errNotScanned and ScanMeta.Interrupted
+// is set. It does nothing when no scan is running.
+func (a *Analyzer) Stop() {
+	a.pauseMu.Lock()
+	defer a.pauseMu.Unlock()
+	if a.stop != nil {
+		a.stop()
+		a.stopped = true
+	}
+}
+
+// Stopped reports whether Stop ended the last scan early.
+func (a *Analyzer) Stopped() bool {
+	a.pauseMu.Lock()
+	defer a.pauseMu.Unlock()
+	return a.stopped
+}
+
+// waitWhilePaused returns when the scan is resumed or ctx is done.
+func (a *Analyzer) waitWhilePaused(ctx context.Context) {
+	a.pauseMu.Lock()
+	resumed := a.resumed
+	a.pauseMu.Unlock()
+	if resumed != nil {
+		select {
+		case <-resumed:
+		case <-ctx.Done():
+		}
+	}
+}
+
+// PingResult is the outcome of a single echo request.
+type PingResult struct {
+	IP      net.IP
+	Replied bool
+	RTT     time.Duration
+	TTL     int
+}
+
+// PingOnce sends a single echo request to ip and waits for the reply until
+// ctx is done or the timeout passes. A missing reply is not an error.
+func (a *Analyzer) PingOnce(ctx context.Context, ip net.IP) (PingResult, error) {
+	ctx, cancel := context.WithTimeout(ctx, a.opts.Timeout)
+	defer cancel()
+
+	result := PingResult{IP: ip}
+	stats, err := a.single.Ping(ctx, ip, func(packet *ping.Packet) {
+		result.TTL = max(result.TTL, packet.Ttl)
+	})
+	if err != nil {
+		return result, err
+	}
+	if stats != nil && stats.PacketsRecv > 0 {
+		result.Replied = true
+		result.RTT = stats.AvgRtt
+	}
+	return result, nil
+}
+
+// Method describes how the hosts are probed, for example "ICMP echo".
+func (a *Analyzer) Method() string {
+	var method string
+	switch {
+	case a.opts.Prober != nil:
+		if name, ok := a.opts.Prober.(fmt.Stringer); ok {
+			return name.String()
+		}
+		return "custom prober"
+	case a.opts.Pinger != nil:
+		if name, ok := a.opts.Pinger.(fmt.Stringer); ok {
+			return name.String()
+		}
+		return "custom prober"
+	case a.opts.UDPPort != 0:
+		method = fmt.Sprintf("UDP port %d", a.opts.UDPPort) + lo.If(a.opts.WithICMP, " and ICMP echo").Else("")
+	case len(a.opts.TCPPorts) > 0:
+		ports := make([]string, len(a.opts.TCPPorts))
+		for i, port := range a.opts.TCPPorts {
+			ports[i] = strconv.Itoa(port)
+		}
+		method = "TCP connect to port " + strings.Join(ports, ", ") + lo.If(a.opts.WithICMP, " and ICMP echo").Else("")
+		if a.opts.RequireAll && len(ports) > 1 {
+			method += ", all open"
+		}
+	default:
+		method = "ICMP echo"
+	}
+	if a.opts.ND {
+		method += ", neighbor discovery on local IPv6 links"
+	}
+	return method
+}
+
+// methods returns the probe methods of a scan with a single one.
+func (a *Analyzer) methods() []string {
+	switch {
+	case a.opts.Pinger != nil, a.opts.Prober != nil:
+		return nil
+	case a.opts.UDPPort != 0:
+		return []string{methodUDP}
+	case len(a.opts.TCPPorts) > 0:
+		return []string{methodTCP}
+	default:
+		return []string{methodICMP}
+	}
+}
+
+// Progress returns how many addresses of the current or last scan have been
+// probed so far, out of how many.
+func (a *Analyzer) Progress() (done, total int) {
+	return int(a.done.Load()), int(a.total.Load())
+}
+
+// cached returns the result of address from the cache, if there is one.
+func (a *Analyzer) cached(address target) (Result, bool) {
+	if a.opts.Cache == nil {
+		return Result{}, false
+	}
+	return a.opts.Cache.Get(address)
+}
+
+// ClearHostnames forgets the hostnames cached by earlier scans, so that the
+// next scan looks them up again.
+func (a *Analyzer) ClearHostnames() {
+	a.resolver.cache.Clear()
+}
+
+// SetNote replaces the note of ip in Options.Notes, see noteStore.Set.
+func (a *Analyzer) SetNote(ip net.IP, note string) error {
+	if a.opts.Notes == nil {
+		return errors.New("Notes are disabled: -notes-file is empty")
+	}
+	if err := a.opts.Notes.Set(ip, note); err != nil {
+		return fmt.Errorf("Unable to save note: %w", err)
+	}
+	return nil
+}
+
+// Trace reports the hops on the way to ip through onHop as they are found.
+func (a *Analyzer) Trace(ctx context.Context, ip net.IP, onHop func(Hop)) error {
+	return a.tracer.Trace(ctx, ip, onHop)
+}
+
+var (
+	// errHostTimeout is the error of hosts that took longer than
+	// Options.HostTimeout.
+	errHostTimeout = errors.New("host timeout exceeded")
+
+	// errNotScanned is the error of hosts that were not probed before the
+	// deadline of the scan.
+	errNotScanned = errors.New("not scanned")
+
+	// errNoStatistics is the error of hosts whose pinger returned without
+	// statistics that show a probe was sent.
+	errNoStatistics = errors.New("no ping statistics")
+
+	// errPacketLoss is the error of hosts that answered, but lost at least
+	// Options.MaxLoss of the probes.
+	errPacketLoss = errors.New("too much packet loss")
+)
+
+// ErrorClass sorts the error of an unknown host into a few classes, such as
+// "timeout" or "network unreachable", so that hosts that failed the same way
+// can be counted together. It returns an empty string for hosts without an
+// error.
+func (r Result) ErrorClass() string {
+	err := r.Err
+	switch {
+	case err == nil:
+		return ""
+	case errors.Is(err, errNotScanned):
+		return "not scanned"
+	case errors.Is(err, errHostTimeout), errors.Is(err, context.DeadlineExceeded), errors.Is(err, os.ErrDeadlineExceeded):
+		return "timeout"
+	case errors.Is(err, errNoStatistics):
+		return "no ping statistics"
+	case errors.Is(err, errPacketLoss):
+		return "packet loss"
+	case errors.Is(err, syscall.ENETUNREACH):
+		return "network unreachable"
+	case errors.Is(err, syscall.EHOSTUNREACH):
+		return "host unreachable"
+	case errors.Is(err, os.ErrPermission):
+		return "permission denied"
+	case isResourceError(err):
+		return "out of resources"
+	default:
+		return "other"
+	}
+}
+
+// probeWithin probes address, giving up after Options.HostTimeout or when
+// scanCtx is done. A probe that is given up on keeps running in the
+// background, but its result is dropped.
+func (a *Analyzer) probeWithin(scanCtx context.Context, address target, timeouts *timeoutTracker) (Result, error) {
+	ctx, cancel := scanCtx, context.CancelFunc(func() {})
+	if a.opts.HostTimeout > 0 {
+		ctx, cancel = context.WithTimeout(scanCtx, a.opts.HostTimeout)
+	}
+	defer cancel()
+
+	type outcome struct {
+		result Result
+		err    error
+	}
+	done := make(chan outcome, 1)
+	go func() {
+		result, err := a.probe(ctx, address, timeouts)
+		done <- outcome{result, err}
+	}()
+
+	select {
+	case o := <-done:
+		// A ping cut short by the deadline looks like a free host, so the
+		// deadline wins even when the probe returned.
+		if ctx.Err() == nil || isSetupError(o.err) {
+			return o.result, o.err
+		}
+	case <-ctx.Done():
+	}
+	if scanCtx.Err() != nil {
+		return Result{IP: address.IP, Blocks: address.Blocks, Err: errNotScanned}, errNotScanned
+	}
+	logger.Debug("host timeout exceeded", "ip", address.IP, "timeout", a.opts.HostTimeout)
+	return Result{IP: address.IP, Blocks: address.Blocks, Err: errHostTimeout}, errHostTimeout
+}
+
+func (a *Analyzer) probe(ctx context.Context, address target, timeouts *timeoutTracker) (Result, error) {
+	if a.opts.Prober != nil {
+		result, err := a.opts.Prober.Probe(ctx, address.IP)
+		result.IP, result.Blocks = address.IP, address.Blocks
+		if err != nil {
+			result.Used, result.Err = false, err
+		}
+		return result, err
+	}
+
+	var ttl int
+	onRecv := func(packet *ping.Packet) {
+		ttl = max(ttl, packet.Ttl)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeouts.Timeout())
+	defer cancel()
+
+	stats, err := a.pinger.Ping(ctx, address.IP, onRecv)
+	if err == nil && !repairStats(stats) {
+		logger.Debug("probe returned no statistics", "ip", address.IP, "stats", stats != nil)
+		err = errNoStatistics
+	}
+	if stats != nil && a.opts.Pinger == nil {
+		a.packets.Add(int64(stats.PacketsSent))
+		a.bytes.Add(int64(countBytes(a.pinger, address.IP, stats)))
+	}
+	if err != nil && a.opts.UnreachableAsFree && (errors.Is(err, syscall.ENETUNREACH) || errors.Is(err, syscall.EHOSTUNREACH)) {
+		// Nothing can use an address there is no route to.
+		logger.Debug("unreachable, counting as free", "ip", address.IP, "err", err)
+		return Result{IP: address.IP, Blocks: address.Blocks}, nil
+	}
+	if err != nil {
+		return Result{IP: address.IP, Blocks: address.Blocks, Err: err}, err
+	}
+
+	result := Result{IP: address.IP, Blocks: address.Blocks, TTL: ttl, Confidence: confidence(stats)}
+	if a.opts.ARP && stats.PacketsRecv > 0 {
+		macs, err := lookupMACs(address.IP)
+		if err != nil {
+			logger.Debug("arp lookup failed", "ip", address.IP, "err", err)
+		}
+		result.MACs = macs
+	}
+	if detailer, ok := a.pinger.(hostDetailer); ok {
+		detailer.addDetails(&result)
+	}
+	if stats.PacketsRecv > 0 {
+		result.Used = true
+		result.RTT = stats.AvgRtt
+		result.RTTs = slices.Clone(stats.Rtts)
+		result.Jitter = jitter(result.RTTs)
+		timeouts.Observe(stats.AvgRtt)
+		if a.opts.Resolve {
+			result.Hostname = a.resolver.lookup(address.IP)
+		}
+		if result.Hostname == "" && a.opts.MDNS {
+			result.Hostname = lookupMDNS(address.IP)
+		}
+		if result.Hostname == "" && a.opts.NetBIOS && address.IP.To4() != nil {
+			result.Hostname = lookupNetBIOS(address.IP)
+		}
+		if a.opts.SNMPCommunity != "" {
+			result.SNMP = lookupSNMP(address.IP, a.opts.SNMPCommunity)
+			if result.Hostname == "" {
+				result.Hostname = result.SNMP.Name
+			}
+		}
+	}
+	if loss := 1 - result.Confidence; result.Used && a.opts.MaxLoss > 0 && loss >= a.opts.MaxLoss {
+		// A few stray replies on a flaky link do not prove the host is
+		// there, nor that it is not.
+		result.Used = false
+		result.Err = fmt.Errorf("%w: %.0f%% lost", errPacketLoss, loss*100)
+	}
+	if result.Used && result.Methods == nil {
+		result.Methods = a.methods()
+	}
+	if result.Used {
+		// Another scan seeing a different device for the address makes it a
+		// conflict.
+		for _, mac := range a.opts.Compare[address.IP.String()] {
+			result.MACs = addMAC(result.MACs, mac)
+		}
+	}
+	if a.opts.Leases != nil {
+		result.Lease = leaseState(result, a.opts.Leases, time.Now())
+	}
+
+	return result, nil
+}
+
+// jitter returns the standard deviation of rtts.
+func jitter(rtts []time.Duration) time.Duration {
+	if len(rtts) < 2 {
+		return 0
+	}
+	var sum float64
+	for _, rtt := range rtts {
+		sum += float64(rtt)
+	}
+	mean := sum / float64(len(rtts))
+	var variance float64
+	for _, rtt := range rtts {
+		variance += (float64(rtt) - mean) * (float64(rtt) - mean)
+	}
+	return time.Duration(math.Sqrt(variance / float64(len(rtts))))
+}
+
+const (
+	adaptiveMinSamples = 5
+	adaptiveMaxSamples = 64
+	adaptiveFactor     = 4
+	adaptiveMinTimeout = 100 * time.Millisecond
+)
+
+// timeoutTracker hands out the per-host timeout. In adaptive mode it keeps the
+// most recent round-trip times and, once there are enough of them, uses a
+// multiple of their median instead of the fixed timeout.
+type timeoutTracker struct {
+	mu       sync.Mutex
+	fixed    time.Duration
+	adaptive bool
+	samples  []time.Duration
+}
+
+func newTimeoutTracker(fixed time.Duration, adaptive bool) *timeoutTracker {
+	return &timeoutTracker{fixed: fixed, adaptive: adaptive}
+}
+
+func (t *timeoutTracker) Observe(rtt time.Duration) {
+	if !t.adaptive {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.samples = append(t.samples, rtt)
+	if len(t.samples) > adaptiveMaxSamples {
+		t.samples = t.samples[1:]
+	}
+}
+
+func (t *timeoutTracker) Timeout() time.Duration {
+	if !t.adaptive {
+		return t.fixed
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.samples) < adaptiveMinSamples {
+		return t.fixed
+	}
+
+	sorted := slices.Clone(t.samples)
+	slices.Sort(sorted)
+	timeout := adaptiveFactor * sorted[len(sorted)/2]
+
+	return min(max(timeout, adaptiveMinTimeout), t.fixed)
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"slices"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/Alphonnse/ipdefiner/internal/fakenet"
+)
+
+func TestScanFakeNetwork(t *testing.T) {
+	network := fakenet.New()
+	network.AddHost("10.0.0.1", time.Millisecond)
+	network.SetHost("10.0.0.5", fakenet.Host{RTT: 3 * time.Millisecond, Lost: 1})
+	network.AddHost("10.0.0.14", 20*time.Millisecond)
+	network.Fail("10.0.0.9", errors.New("no buffer space available"))
+
+	analyzer := NewAnalizer(Options{Pinger: network, Workers: 4, Timeout: time.Second})
+	results, meta, err := analyzer.Scan([]string{"10.0.0.0/28"})
+	if err != nil {
+		t.Fatalf("Scan: %v", err)
+	}
+	if meta.HostCount != 14 || len(results) != 14 {
+		t.Fatalf("Scan of a /28 gave %d results for %d hosts, want 14", len(results), meta.HostCount)
+	}
+	if pinged := len(network.Pinged()); pinged != 14 {
+		t.Errorf("%d addresses pinged, want 14", pinged)
+	}
+
+	want := map[string]Status{
+		"10.0.0.1":  StatusUsed,
+		"10.0.0.5":  StatusUsed,
+		"10.0.0.9":  StatusUnknown,
+		"10.0.0.14": StatusUsed,
+	}
+	for _, result := range results {
+		status, ok := want[result.IP.String()]
+		if !ok {
+			status = StatusFree
+		}
+		if result.Status() != status {
+			t.Errorf("%s is %s, want %s", result.IP, result.Status(), status)
+		}
+	}
+
+	summary := Summarize(results)
+	if summary.Used != 3 || summary.Free != 10 || summary.Unknown != 1 {
+		t.Errorf("Summarize: %d used, %d free, %d unknown, want 3, 10 and 1", summary.Used, summary.Free, summary.Unknown)
+	}
+}
+
+// fakeProber answers with the results of hosts by IP, every other address
+// being free.
+type fakeProber struct {
+	hosts map[string]Result
+	errs  map[string]error
+}
+
+func (p fakeProber) Probe(ctx context.Context, ip net.IP) (Result, error) {
+	if err := p.errs[ip.String()]; err != nil {
+		return Result{}, err
+	}
+	return p.hosts[ip.String()], nil
+}
+
+func TestScanProber(t *testing.T) {
+	prober := fakeProber{
+		hosts: map[string]Result{
+			"10.0.0.0": {Used: true, RTT: time.Millisecond},
+			"10.0.0.2": {Used: true, RTT: 5 * time.Millisecond},
+			"10.0.0.3": {Used: true, RTT: 2 * time.Millisecond},
+			"10.0.0.6": {Used: true, RTT: 9 * time.Millisecond},
+		},
+		errs: map[string]error{
+			"10.0.0.5": errors.New("no buffer space available"),
+		},
+	}
+	tests := []struct {
+		name     string
+		opts     Options
+		sort     string
+		want     []string
+		statuses map[string]Status
+		wantErr  bool
+	}{
+		{
+			name: "enumeration skips network and broadcast",
+			want: []string{"10.0.0.1", "10.0.0.2", "10.0.0.3", "10.0.0.4", "10.0.0.5", "10.0.0.6"},
+			statuses: map[string]Status{
+				"10.0.0.2": StatusUsed, "10.0.0.3": StatusUsed, "10.0.0.5": StatusUnknown, "10.0.0.6": StatusUsed,
+			},
+		},
+		{
+			name: "enumeration with network and broadcast",
+			opts: Options{Enum: EnumOptions{IncludeNetwork: true, IncludeBroadcast: true}},
+			want: []string{"10.0.0.0", "10.0.0.1", "10.0.0.2", "10.0.0.3", "10.0.0.4", "10.0.0.5", "10.0.0.6", "10.0.0.7"},
+		},
+		{
+			name: "exclusion",
+			opts: Options{Exclude: []string{"10.0.0.4/31"}},
+			want: []string{"10.0.0.1", "10.0.0.2", "10.0.0.3", "10.0.0.6"},
+		},
+		{
+			name: "sorted by status",
+			sort: "status",
+			want: []string{"10.0.0.2", "10.0.0.3", "10.0.0.6", "10.0.0.1", "10.0.0.4", "10.0.0.5"},
+		},
+		{
+			name: "sorted by rtt",
+			sort: "rtt",
+			want: []string{"10.0.0.3", "10.0.0.2", "10.0.0.6", "10.0.0.1", "10.0.0.4", "10.0.0.5"},
+		},
+		{
+			name:    "fail fast",
+			opts:    Options{FailFast: true},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := tt.opts
+			opts.Prober, opts.Workers = prober, 3
+			results, _, err := NewAnalizer(opts).Scan([]string{"10.0.0.0/29"})
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("Scan succeeded, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Scan: %v", err)
+			}
+
+			shown := visibleResults(results, displayOptions{sort: tt.sort})
+			var ips []string
+			for _, result := range shown {
+				ips = append(ips, result.IP.String())
+				if len(result.Blocks) != 1 || result.Blocks[0] != "10.0.0.0/29" {
+					t.Errorf("%s is in pools %v, want 10.0.0.0/29", result.IP, result.Blocks)
+				}
+				if status, ok := tt.statuses[result.IP.String()]; ok && result.Status() != status {
+					t.Errorf("%s is %s, want %s", result.IP, result.Status(), status)
+				}
+			}
+			if !slices.Equal(ips, tt.want) {
+				t.Errorf("results = %v, want %v", ips, tt.want)
+			}
+		})
+	}
+}
+
+// countingProber counts the probes of the Prober it wraps.
+type countingProber struct {
+	Prober
+	probes atomic.Int64
+}
+
+func (p *countingProber) Probe(ctx context.Context, ip net.IP) (Result, error) {
+	p.probes.Add(1)
+	return p.Prober.Probe(ctx, ip)
+}
+
+func TestScanFailFast(t *testing.T) {
+	prober := &countingProber{Prober: fakeProber{
+		hosts: map[string]Result{"10.0.0.1": {Used: true, RTT: time.Millisecond}},
+		errs:  map[string]error{"10.0.0.3": syscall.EHOSTUNREACH},
+	}}
+	results, _, err := NewAnalizer(Options{Prober: prober, Workers: 1, FailFast: true}).Scan([]string{"10.0.0.0/28"})
+	if !errors.Is(err, syscall.EHOSTUNREACH) {
+		t.Fatalf("Scan failed with %v, want %v", err, syscall.EHOSTUNREACH)
+	}
+	if results != nil {
+		t.Errorf("Scan returned %d results along with its error", len(results))
+	}
+	if probes := prober.probes.Load(); probes != 3 {
+		t.Errorf("%d probes started, want 3: none after the first error", probes)
+	}
+}
+
+func TestScanWithoutFailFast(t *testing.T) {
+	prober := &countingProber{Prober: fakeProber{
+		hosts: map[string]Result{"10.0.0.1": {Used: true, RTT: time.Millisecond}},
+		errs:  map[string]error{"10.0.0.3": syscall.EHOSTUNREACH},
+	}}
+	results, _, err := NewAnalizer(Options{Prober: prober, Workers: 1}).Scan([]string{"10.0.0.0/28"})
+	if err != nil {
+		t.Fatalf("Scan: %v", err)
+	}
+	if probes := prober.probes.Load(); probes != 14 || len(results) != 14 {
+		t.Errorf("%d probes and %d results, want 14 of each", probes, len(results))
+	}
+	for _, result := range results {
+		if result.IP.String() != "10.0.0.3" {
+			continue
+		}
+		if result.Status() != StatusUnknown || result.ErrorClass() != "host unreachable" {
+			t.Errorf("10.0.0.3 is %s with error class %q, want %s and %q", result.Status(), result.ErrorClass(), StatusUnknown, "host unreachable")
+		}
+	}
+	if summary := Summarize(results); summary.Used != 1 || summary.Unknown != 1 || summary.ErrorClasses["host unreachable"] != 1 {
+		t.Errorf("Summarize: %d used, %d unknown and error classes %v, want 1, 1 and 1 host unreachable", summary.Used, summary.Unknown, summary.ErrorClasses)
+	}
+}
+
+func TestScanProberSetupError(t *testing.T) {
+	prober := fakeProber{errs: map[string]error{"10.0.0.2": &setupError{errors.New("no such interface")}}}
+	if _, _, err := NewAnalizer(Options{Prober: prober}).Scan([]string{"10.0.0.0/30"}); err == nil {
+		t.Error("Scan succeeded despite a setup error")
+	}
+}
+
+// blockingProber answers only when the context of the probe is done, and
+// counts the probes that returned.
+type blockingProber struct {
+	returned chan struct{}
+}
+
+func (p blockingProber) Probe(ctx context.Context, ip net.IP) (Result, error) {
+	<-ctx.Done()
+	p.returned <- struct{}{}
+	return Result{}, ctx.Err()
+}
+
+func TestScanProberHostTimeout(t *testing.T) {
+	prober := blockingProber{returned: make(chan struct{}, 2)}
+	results, _, err := NewAnalizer(Options{Prober: prober, HostTimeout: 10 * time.Millisecond}).Scan([]string{"10.0.0.0/30"})
+	if err != nil {
+		t.Fatalf("Scan: %v", err)
+	}
+	for _, result := range results {
+		if !errors.Is(result.Err, errHostTimeout) {
+			t.Errorf("%s failed with %v, want %v", result.IP, result.Err, errHostTimeout)
+		}
+	}
+	for range results {
+		select {
+		case <-prober.returned:
+		case <-time.After(time.Second):
+			t.Fatal("a probe was not cancelled by the host timeout")
+		}
+	}
+}
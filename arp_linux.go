@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"net"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	// arpWait is how long lookupMACs collects the replies to its request.
+	arpWait = 300 * time.Millisecond
+
+	arpRequest = 1
+	arpReply   = 2
+
+	// arpPacketLen is the length of an ARP packet for IPv4 over Ethernet.
+	arpPacketLen = 28
+)
+
+// lookupMACs sends an ARP request for ip from the interface whose network
+// holds it and returns the sender addresses of all replies, so that several
+// devices claiming ip show up as several MACs. Hosts off the local networks
+// have none. Without a raw socket, which needs root or CAP_NET_RAW, it falls
+// back to the kernel's ARP table, which only holds one MAC per IP.
+func lookupMACs(ip net.IP) ([]net.HardwareAddr, error) {
+	ip = ip.To4()
+	if ip == nil {
+		return nil, nil
+	}
+	iface, source, err := arpSource(ip)
+	if err != nil || iface == nil {
+		return nil, err
+	}
+
+	fd, err := syscall.Socket(syscall.AF_PACKET, syscall.SOCK_DGRAM, int(htons(syscall.ETH_P_ARP)))
+	if errors.Is(err, syscall.EPERM) {
+		logger.Debug("no raw socket for ARP, reading the ARP table", "ip", ip)
+		mac, err := lookupARPTable(ip)
+		if mac == nil {
+			return nil, err
+		}
+		return []net.HardwareAddr{mac}, err
+	}
+	if err != nil {
+		return nil, os.NewSyscallError("socket", err)
+	}
+	defer syscall.Close(fd)
+
+	link := &syscall.SockaddrLinklayer{Protocol: htons(syscall.ETH_P_ARP), Ifindex: iface.Index}
+	if err := syscall.Bind(fd, link); err != nil {
+		return nil, os.NewSyscallError("bind", err)
+	}
+	request := make([]byte, arpPacketLen)
+	binary.BigEndian.PutUint16(request[0:], syscall.ARPHRD_ETHER)
+	binary.BigEndian.PutUint16(request[2:], syscall.ETH_P_IP)
+	request[4], request[5] = 6, 4
+	binary.BigEndian.PutUint16(request[6:], arpRequest)
+	copy(request[8:], iface.HardwareAddr)
+	copy(request[14:], source)
+	copy(request[24:], ip)
+	broadcast := &syscall.SockaddrLinklayer{Protocol: htons(syscall.ETH_P_ARP), Ifindex: iface.Index, Halen: 6}
+	copy(broadcast.Addr[:], []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff})
+	if err := syscall.Sendto(fd, request, 0, broadcast); err != nil {
+		return nil, os.NewSyscallError("sendto", err)
+	}
+
+	var macs []net.HardwareAddr
+	buf := make([]byte, 128)
+	for deadline := time.Now().Add(arpWait); time.Now().Before(deadline); {
+		timeout := syscall.NsecToTimeval(time.Until(deadline).Nanoseconds())
+		if err := syscall.SetsockoptTimeval(fd, syscall.SOL_SOCKET, syscall.SO_RCVTIMEO, &timeout); err != nil {
+			return macs, os.NewSyscallError("setsockopt", err)
+		}
+		n, _, err := syscall.Recvfrom(fd, buf, 0)
+		if errors.Is(err, syscall.EAGAIN) || errors.Is(err, syscall.EINTR) {
+			continue
+		}
+		if err != nil {
+			return macs, os.NewSyscallError("recvfrom", err)
+		}
+		if n < arpPacketLen || binary.BigEndian.Uint16(buf[6:]) != arpReply || !net.IP(buf[14:18]).Equal(ip) {
+			continue
+		}
+		macs = addMAC(macs, net.HardwareAddr(append([]byte(nil), buf[8:14]...)))
+	}
+	return macs, nil
+}
+
+// arpSource returns the interface whose IPv4 network holds ip and its address
+// there, or a nil interface if ip is not on a local network.
+func arpSource(ip net.IP) (*net.Interface, net.IP, error) {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagLoopback != 0 || len(iface.HardwareAddr) != 6 {
+			continue
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.To4() != nil && ipNet.Contains(ip) {
+				return &iface, ipNet.IP.To4(), nil
+			}
+		}
+	}
+	return nil, nil, nil
+}
+
+// lookupARPTable returns the hardware address the kernel's ARP table
+// currently holds for ip, or nil if there is no complete entry for it.
+func lookupARPTable(ip net.IP) (net.HardwareAddr, error) {
+	f, err := os.Open("/proc/net/arp")
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Scan()
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 4 || !net.ParseIP(fields[0]).Equal(ip) {
+			continue
+		}
+		mac, err := net.ParseMAC(fields[3])
+		if err != nil || mac.String() == "00:00:00:00:00:00" {
+			return nil, nil
+		}
+		return mac, nil
+	}
+
+	return nil, scanner.Err()
+}
+
+func htons(v uint16) uint16 {
+	return v<<8 | v>>8
+}
@@ -0,0 +1,12 @@
+//go:build !linux
+
+package main
+
+import (
+	"errors"
+	"net"
+)
+
+func lookupMACs(ip net.IP) ([]net.HardwareAddr, error) {
+	return nil, errors.New("ARP lookup is only supported on Linux")
+}
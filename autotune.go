@@ -0,0 +1,117 @@
+package main
+
+import (
+	"errors"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	// autoWorkersStart is the number of workers -auto-workers starts with.
+	autoWorkersStart = 16
+	// autoWorkersWindow is the least number of probes the error rate is
+	// judged on before the number of workers changes.
+	autoWorkersWindow = 32
+	// autoWorkersMaxErrorRate is the share of probes that may run out of
+	// resources before the number of workers is halved.
+	autoWorkersMaxErrorRate = 0.05
+	// autoWorkersRetries is how often a probe that ran out of resources is
+	// repeated, after autoWorkersRetryDelay times the attempt so that fewer
+	// workers run by then.
+	autoWorkersRetries    = 3
+	autoWorkersRetryDelay = 200 * time.Millisecond
+)
+
+// workerTuner limits how many workers probe at the same time. It starts low
+// and doubles the limit, up to max, after every window of probes that did not
+// run out of sockets or buffers, and halves it when too many of them did.
+// After a failure it only grows back halfway to the limit that failed. A nil
+// workerTuner does not limit anything.
+type workerTuner struct {
+	max int
+
+	mu             sync.Mutex
+	cond           *sync.Cond
+	limit, active  int
+	probes, errors int
+}
+
+func newWorkerTuner(max int) *workerTuner {
+	t := &workerTuner{max: max, limit: min(autoWorkersStart, max)}
+	t.cond = sync.NewCond(&t.mu)
+	return t
+}
+
+// acquire waits until another probe may start.
+func (t *workerTuner) acquire() {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for t.active >= t.limit {
+		t.cond.Wait()
+	}
+	t.active++
+}
+
+// release ends a probe that failed with err, or succeeded if err is nil, and
+// adjusts the limit once a window of probes is complete. It reports whether
+// the probe ran out of resources and says nothing about the host, so that it
+// should be repeated.
+func (t *workerTuner) release(err error) bool {
+	if t == nil {
+		return false
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	defer t.cond.Broadcast()
+
+	t.active--
+	t.probes++
+	exhausted := isResourceError(err)
+	if exhausted {
+		t.errors++
+	}
+	if t.probes < max(autoWorkersWindow, t.limit) {
+		return exhausted
+	}
+
+	rate := float64(t.errors) / float64(t.probes)
+	limit := t.limit
+	switch {
+	case rate > autoWorkersMaxErrorRate:
+		// The limit that works is somewhere between half the failed one
+		// and the failed one: only grow back halfway.
+		limit = max(t.limit/2, 1)
+		t.max = limit + (t.limit-limit)/2
+	case t.errors == 0:
+		limit = min(t.limit*2, t.max)
+	}
+	if limit != t.limit {
+		logger.Info("adjusting workers", "workers", limit, "error_rate", rate)
+		t.limit = limit
+	}
+	t.probes, t.errors = 0, 0
+	return exhausted
+}
+
+// Limit returns the current number of workers, or 0 for a nil workerTuner.
+func (t *workerTuner) Limit() int {
+	if t == nil {
+		return 0
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.limit
+}
+
+// isResourceError reports whether err means that the host ran out of
+// sockets, file descriptors or buffers, rather than that the probed address
+// misbehaved.
+func isResourceError(err error) bool {
+	return errors.Is(err, syscall.EAGAIN) || errors.Is(err, syscall.EMFILE) ||
+		errors.Is(err, syscall.ENFILE) || errors.Is(err, syscall.ENOBUFS) ||
+		errors.Is(err, syscall.ENOMEM)
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// resultCache remembers hosts that answered recently so that a rescan within
+// the TTL can skip them. Only used hosts are cached: a free host may come up
+// at any time. It is safe for concurrent use.
+type resultCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	path    string
+	entries map[string]cacheEntry
+}
+
+type cacheEntry struct {
+	Seen     time.Time     `json:"seen"`
+	RTT      time.Duration `json:"rtt"`
+	TTL      int           `json:"ttl,omitempty"`
+	Hostname string        `json:"hostname,omitempty"`
+}
+
+// defaultCachePath returns the file the cache is kept in between runs, or an
+// empty string if there is no cache directory.
+func defaultCachePath() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "ipdefiner", "results.json")
+}
+
+// newResultCache returns a cache for ttl, loaded from path unless path is
+// empty. A missing or unreadable file starts an empty cache.
+func newResultCache(ttl time.Duration, path string) *resultCache {
+	c := &resultCache{ttl: ttl, path: path, entries: make(map[string]cacheEntry)}
+	if path == "" {
+		return c
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			logger.Warn("reading cache failed", "file", path, "err", err)
+		}
+		return c
+	}
+	if err := json.Unmarshal(data, &c.entries); err != nil {
+		logger.Warn("cache is invalid, starting over", "file", path, "err", err)
+		c.entries = make(map[string]cacheEntry)
+	}
+	return c
+}
+
+// Get returns the cached result of address if it was seen within the TTL.
+func (c *resultCache) Get(address target) (Result, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[address.IP.String()]
+	if !ok || time.Since(entry.Seen) > c.ttl {
+		return Result{}, false
+	}
+	return Result{
+		IP:         address.IP,
+		Blocks:     address.Blocks,
+		Used:       true,
+		RTT:        entry.RTT,
+		TTL:        entry.TTL,
+		Hostname:   entry.Hostname,
+		Confidence: 1,
+		Cached:     true,
+	}, true
+}
+
+// Put remembers result if the host is used.
+func (c *resultCache) Put(result Result) {
+	if !result.Used || result.Cached {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[result.IP.String()] = cacheEntry{Seen: time.Now(), RTT: result.RTT, TTL: result.TTL, Hostname: result.Hostname}
+}
+
+// Save drops expired entries and writes the rest to the cache file, if any.
+func (c *resultCache) Save() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for ip, entry := range c.entries {
+		if time.Since(entry.Seen) > c.ttl {
+			delete(c.entries, ip)
+		}
+	}
+	if c.path == "" {
+		return nil
+	}
+
+	data, err := json.Marshal(c.entries)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(c.path), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(c.path, data, 0o644)
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+	"github.com/samber/lo"
+)
+
+// The prefix lengths offered by the CIDR builder stop at the largest pool
+// that can be scanned.
+var (
+	builderPrefixesV4 = prefixRange(32-maxHostBits, 32)
+	builderPrefixesV6 = prefixRange(128-maxHostBits, 128)
+)
+
+func prefixRange(from, to int) []int {
+	var prefixes []int
+	for prefix := from; prefix <= to; prefix++ {
+		prefixes = append(prefixes, prefix)
+	}
+	return prefixes
+}
+
+// askTargets shows the input screen: a free-text field for the pools and,
+// below it, a form that builds a pool from a base IP and a prefix length
+// picked from a list, with a preview of the resulting network. Tab moves
+// between the two. The text field is validated as it is typed and only
+// accepted when valid; Up and Down recall the pools of history, which the
+// entered pools are added to unless history is nil. It returns the entered
+// pools in their network form, or an empty string if the user quits.
+func askTargets(app *tview.Application, theme Theme, history targetHistory) (string, error) {
+	var (
+		text    string
+		entries []string
+	)
+	if history != nil {
+		var err error
+		if entries, err = history.Load(); err != nil {
+			logger.Warn("reading input history failed", "err", err)
+		}
+	}
+	// remember adds the entered pools to the history.
+	remember := func() {
+		if history == nil {
+			return
+		}
+		if err := history.Save(addToHistory(entries, text)); err != nil {
+			logger.Warn("saving input history failed", "err", err)
+		}
+	}
+
+	const label = "Enter address and mask prefix to analyze: "
+	inputField := tview.NewInputField().
+		SetLabel(label).
+		SetFieldWidth(inputFieldWidth)
+	indicator := tview.NewTextView().SetDynamicColors(true)
+	validate := func(text string) {
+		indicator.Clear()
+		if strings.TrimSpace(text) == "" {
+			return
+		}
+		if blocks, err := validateTargets(text); err != nil {
+			fmt.Fprint(indicator, theme.Paint(theme.Warning, "✗ "+tview.Escape(err.Error())))
+		} else {
+			fmt.Fprint(indicator, theme.Paint(theme.Used, "✓ "+strings.Join(blocks, ", ")))
+		}
+	}
+	inputField.SetChangedFunc(validate)
+
+	// recalled is the index in entries of the shown entry, len(entries)
+	// while the user's own text is shown, which draft keeps meanwhile.
+	recalled, draft := len(entries), ""
+	inputField.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		next := recalled
+		switch event.Key() {
+		case tcell.KeyUp:
+			next = max(recalled-1, 0)
+		case tcell.KeyDown:
+			next = min(recalled+1, len(entries))
+		default:
+			return event
+		}
+		if next != recalled {
+			if recalled == len(entries) {
+				draft = inputField.GetText()
+			}
+			recalled = next
+			if recalled < len(entries) {
+				inputField.SetText(entries[recalled])
+			} else {
+				inputField.SetText(draft)
+			}
+		}
+		return nil
+	})
+
+	preview := tview.NewTextView().SetDynamicColors(true)
+	form := tview.NewForm()
+	form.SetBorder(true).SetTitle(" Or build it from a base IP ")
+
+	var (
+		prefixes = builderPrefixesV4
+		prefix   = 24
+	)
+	baseField := tview.NewInputField().SetLabel("Base IP").SetFieldWidth(inputFieldWidth * 2)
+	prefixList := tview.NewDropDown().SetLabel("Prefix length")
+
+	cidr := func() string {
+		base := strings.TrimSpace(baseField.GetText())
+		// An IPv4-mapped IPv6 address takes the IPv4 prefix lengths.
+		if ip := net.ParseIP(base); ip != nil {
+			base = ip.String()
+		}
+		return base + fmt.Sprintf("/%d", prefix)
+	}
+	update := func() {
+		preview.Clear()
+		if strings.TrimSpace(baseField.GetText()) == "" {
+			fmt.Fprint(preview, "  Enter an IP of the network, e.g. 192.168.1.10")
+			return
+		}
+		info, err := subnetInfo(cidr())
+		if err != nil {
+			fmt.Fprint(preview, theme.Paint(theme.Warning, "  "+tview.Escape(err.Error())))
+			return
+		}
+		var b bytes.Buffer
+		writeSubnetInfo(&b, info)
+		fmt.Fprint(preview, tview.Escape(b.String()))
+	}
+	setPrefixes := func(list []int, selected int) {
+		prefixes = list
+		options := make([]string, len(list))
+		current := 0
+		for i, p := range list {
+			options[i] = prefixLabel(p, list[len(list)-1])
+			if p == selected {
+				current = i
+			}
+		}
+		prefix = selected
+		prefixList.SetOptions(options, func(_ string, index int) {
+			prefix = prefixes[index]
+			update()
+		})
+		prefixList.SetCurrentOption(current)
+	}
+	setPrefixes(builderPrefixesV4, 24)
+
+	baseField.SetChangedFunc(func(base string) {
+		ip := net.ParseIP(strings.TrimSpace(base))
+		switch v6 := prefixes[len(prefixes)-1] == 128; {
+		case ip == nil:
+		case ip.To4() == nil && !v6:
+			setPrefixes(builderPrefixesV6, 120)
+		case ip.To4() != nil && v6:
+			setPrefixes(builderPrefixesV4, 24)
+		}
+		update()
+	})
+
+	form.AddFormItem(baseField).AddFormItem(prefixList).
+		AddButton("Scan", func() {
+			if info, err := subnetInfo(cidr()); err == nil {
+				text = fmt.Sprintf("%s/%d", info.Network, info.Prefix)
+				remember()
+				app.Stop()
+			}
+		})
+	form.SetCancelFunc(func() {
+		app.SetFocus(inputField)
+	})
+	update()
+
+	inputField.SetDoneFunc(func(key tcell.Key) {
+		switch key {
+		case tcell.KeyTab, tcell.KeyBacktab:
+			app.SetFocus(form)
+		case tcell.KeyEnter:
+			blocks, err := validateTargets(inputField.GetText())
+			if err != nil {
+				indicator.Clear()
+				fmt.Fprint(indicator, theme.Paint(theme.Warning, "✗ "+tview.Escape(err.Error())))
+				return
+			}
+			text = strings.Join(blocks, " ")
+			remember()
+			app.Stop()
+		default:
+			app.Stop()
+		}
+	})
+
+	help := tview.NewTextView().SetText("Up and Down recall earlier pools, Tab switches between the field and the form, Esc in the form goes back")
+	inputRow := tview.NewFlex().
+		AddItem(inputField, len(label)+inputFieldWidth+1, 0, true).
+		AddItem(indicator, 0, 1, false)
+	layout := tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(inputRow, 2, 0, true).
+		AddItem(form, 9, 0, false).
+		AddItem(preview, 3, 0, false).
+		AddItem(help, 1, 0, false).
+		AddItem(nil, 0, 1, false)
+
+	if err := app.SetRoot(layout, true).SetFocus(inputField).Run(); err != nil {
+		return "", err
+	}
+	return text, nil
+}
+
+// validateTargets checks the pools of text, separated by spaces or commas,
+// and returns them in their network form, so that 10.0.0.5/24 becomes
+// 10.0.0.0/24.
+func validateTargets(text string) ([]string, error) {
+	targets := parseTargets(text)
+	if len(targets) == 0 {
+		return nil, errors.New("Enter an address and mask prefix, e.g. 192.168.1.0/24")
+	}
+	for _, target := range targets {
+		if _, err := subnetInfo(target); err != nil {
+			return nil, err
+		}
+	}
+	return canonicalBlocks(targets), nil
+}
+
+// prefixLabel describes a prefix length by the number of usable hosts, e.g.
+// "/24 (254 hosts)" for IPv4.
+func prefixLabel(prefix, bits int) string {
+	network := lo.Ternary(bits == 32, "0.0.0.0", "::")
+	info, err := subnetInfo(fmt.Sprintf("%s/%d", network, prefix))
+	if err != nil {
+		return fmt.Sprintf("/%d", prefix)
+	}
+	return fmt.Sprintf("/%d (%d hosts)", prefix, info.Hosts)
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+
+	"github.com/samber/lo"
+)
+
+// readComparison reads the MAC addresses per IP from the output of an earlier
+// scan, written with -format json or -format jsonl.
+func readComparison(path string) (map[string][]net.HardwareAddr, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to open scan to compare with: %w", err)
+	}
+	defer f.Close()
+
+	macs := make(map[string][]net.HardwareAddr)
+	add := func(r jsonResult) error {
+		for _, s := range r.MACs {
+			mac, err := net.ParseMAC(s)
+			if err != nil {
+				return fmt.Errorf("Invalid MAC address %q of %s in %s", s, r.IP, path)
+			}
+			ip := net.ParseIP(r.IP)
+			if ip == nil {
+				return fmt.Errorf("Invalid address %q in %s", r.IP, path)
+			}
+			macs[ip.String()] = addMAC(macs[ip.String()], mac)
+		}
+		return nil
+	}
+
+	dec := json.NewDecoder(f)
+	for {
+		// A report of -format json, or a line of -format jsonl.
+		var doc struct {
+			jsonResult
+			Results []jsonResult         `json:"results"`
+			Groups  map[string]jsonGroup `json:"groups"`
+		}
+		err := dec.Decode(&doc)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Unable to read scan to compare with %s: %w", path, err)
+		}
+
+		results := doc.Results
+		for _, group := range doc.Groups {
+			results = append(results, group.Results...)
+		}
+		if doc.IP != "" {
+			results = append(results, doc.jsonResult)
+		}
+		for _, r := range results {
+			if err := add(r); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return macs, nil
+}
+
+// addMAC adds mac to macs unless it is already there.
+func addMAC(macs []net.HardwareAddr, mac net.HardwareAddr) []net.HardwareAddr {
+	if lo.ContainsBy(macs, func(m net.HardwareAddr) bool { return bytes.Equal(m, mac) }) {
+		return macs
+	}
+	return append(macs, mac)
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// defaultConfigPath returns the path of the config file that is read when
+// -config is not given, or an empty string if there is no config directory.
+func defaultConfigPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "ipdefiner", "config.yaml")
+}
+
+// envPrefix starts the environment variables that set flags, see applyEnv.
+const envPrefix = "IPDEFINER_"
+
+// givenFlags returns the names of the flags that have been set so far.
+func givenFlags() map[string]bool {
+	given := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) {
+		given[f.Name] = true
+	})
+	return given
+}
+
+// envName returns the environment variable for the named flag, for example
+// IPDEFINER_DRY_RUN for -dry-run.
+func envName(name string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+// applyEnv sets every flag that is not in given from its environment variable,
+// if that is set, and adds it to given.
+func applyEnv(given map[string]bool) error {
+	var err error
+	flag.VisitAll(func(f *flag.Flag) {
+		value, ok := os.LookupEnv(envName(f.Name))
+		if !ok || given[f.Name] || err != nil {
+			return
+		}
+		if setErr := flag.Set(f.Name, value); setErr != nil {
+			err = fmt.Errorf("Invalid %s: %w", envName(f.Name), setErr)
+			return
+		}
+		given[f.Name] = true
+	})
+	return err
+}
+
+// applyConfig reads the YAML config file at path and sets every flag it names
+// that is not in given. Keys are flag names, for example:
+//
+//	workers: 64
+//	timeout: 2s
+//	exclude: [10.0.0.0/29, 10.0.0.255/32]
+//
+// A missing file is only an error if it was asked for explicitly.
+func applyConfig(path string, explicit bool, given map[string]bool) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) && !explicit {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("Unable to read config file: %w", err)
+	}
+
+	var settings map[string]any
+	if err := yaml.Unmarshal(data, &settings); err != nil {
+		return fmt.Errorf("Invalid config file %s: %w", path, err)
+	}
+
+	for name, value := range settings {
+		if flag.Lookup(name) == nil || name == "config" {
+			return fmt.Errorf("Unknown setting %q in config file %s", name, path)
+		}
+		if given[name] {
+			continue
+		}
+
+		values, ok := value.([]any)
+		if !ok {
+			values = []any{value}
+		}
+		for _, v := range values {
+			if err := flag.Set(name, fmt.Sprint(v)); err != nil {
+				return fmt.Errorf("Invalid setting %s in config file %s: %w", name, path, err)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestFlagPrecedence(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		env      map[string]string
+		config   string
+		workers  int
+		timeout  time.Duration
+		excludes []string
+	}{
+		{
+			name:    "defaults",
+			workers: 10,
+			timeout: time.Second,
+		},
+		{
+			name:     "config file",
+			config:   "workers: 64\ntimeout: 2s\nexclude: [10.0.0.0/29, 10.0.0.255/32]\n",
+			workers:  64,
+			timeout:  2 * time.Second,
+			excludes: []string{"10.0.0.0/29", "10.0.0.255/32"},
+		},
+		{
+			name:     "environment over config file",
+			env:      map[string]string{"IPDEFINER_WORKERS": "32", "IPDEFINER_EXCLUDE": "10.0.0.1"},
+			config:   "workers: 64\ntimeout: 2s\nexclude: [10.0.0.0/29]\n",
+			workers:  32,
+			timeout:  2 * time.Second,
+			excludes: []string{"10.0.0.1"},
+		},
+		{
+			name:     "flags over environment and config file",
+			args:     []string{"-workers", "8", "-exclude", "10.0.0.2"},
+			env:      map[string]string{"IPDEFINER_WORKERS": "32", "IPDEFINER_TIMEOUT": "3s"},
+			config:   "workers: 64\ntimeout: 2s\nexclude: [10.0.0.0/29]\n",
+			workers:  8,
+			timeout:  3 * time.Second,
+			excludes: []string{"10.0.0.2"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				workers  int
+				timeout  time.Duration
+				excludes stringList
+			)
+			defer func(commandLine *flag.FlagSet) { flag.CommandLine = commandLine }(flag.CommandLine)
+			flag.CommandLine = flag.NewFlagSet("ipdefiner", flag.ContinueOnError)
+			flag.IntVar(&workers, "workers", 10, "")
+			flag.DurationVar(&timeout, "timeout", time.Second, "")
+			flag.Var(&excludes, "exclude", "")
+			if err := flag.CommandLine.Parse(tt.args); err != nil {
+				t.Fatal(err)
+			}
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+			path := filepath.Join(t.TempDir(), "config.yaml")
+			if tt.config != "" {
+				if err := os.WriteFile(path, []byte(tt.config), 0o600); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			given := givenFlags()
+			if err := applyEnv(given); err != nil {
+				t.Fatalf("applyEnv: %v", err)
+			}
+			if err := applyConfig(path, false, given); err != nil {
+				t.Fatalf("applyConfig: %v", err)
+			}
+			if workers != tt.workers || timeout != tt.timeout {
+				t.Errorf("workers = %d, timeout = %s, want %d and %s", workers, timeout, tt.workers, tt.timeout)
+			}
+			if !slices.Equal(excludes, tt.excludes) {
+				t.Errorf("excludes = %v, want %v", excludes, tt.excludes)
+			}
+		})
+	}
+}
+
+func TestApplyConfigErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+	}{
+		{"unknown setting", "wokers: 64\n"},
+		{"config names itself", "config: other.yaml\n"},
+		{"invalid value", "workers: many\n"},
+		{"invalid YAML", "workers: [64\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var workers int
+			defer func(commandLine *flag.FlagSet) { flag.CommandLine = commandLine }(flag.CommandLine)
+			flag.CommandLine = flag.NewFlagSet("ipdefiner", flag.ContinueOnError)
+			flag.IntVar(&workers, "workers", 10, "")
+			flag.String("config", "", "")
+
+			path := filepath.Join(t.TempDir(), "config.yaml")
+			if err := os.WriteFile(path, []byte(tt.config), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			if err := applyConfig(path, true, givenFlags()); err == nil {
+				t.Errorf("applyConfig accepted %q", tt.config)
+			}
+		})
+	}
+
+	if err := applyConfig(filepath.Join(t.TempDir(), "missing.yaml"), false, nil); err != nil {
+		t.Errorf("a missing default config file failed: %v", err)
+	}
+	if err := applyConfig(filepath.Join(t.TempDir(), "missing.yaml"), true, nil); err == nil {
+		t.Error("a missing config file given with -config was accepted")
+	}
+}
+
+func TestApplyEnvInvalid(t *testing.T) {
+	var workers int
+	defer func(commandLine *flag.FlagSet) { flag.CommandLine = commandLine }(flag.CommandLine)
+	flag.CommandLine = flag.NewFlagSet("ipdefiner", flag.ContinueOnError)
+	flag.IntVar(&workers, "workers", 10, "")
+
+	t.Setenv("IPDEFINER_WORKERS", "many")
+	if err := applyEnv(givenFlags()); err == nil {
+		t.Error("applyEnv accepted IPDEFINER_WORKERS=many")
+	}
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"net"
+	"slices"
+	"strings"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// dbBatchSize is the number of observations written with a single INSERT, so
+// that large scans do not take a statement per IP.
+const dbBatchSize = 500
+
+const dbSchema = `
+CREATE TABLE IF NOT EXISTS scans (
+	id          INTEGER PRIMARY KEY,
+	started     TEXT NOT NULL,
+	finished    TEXT NOT NULL,
+	pools       TEXT NOT NULL,
+	hosts       INTEGER NOT NULL,
+	used        INTEGER NOT NULL,
+	free        INTEGER NOT NULL,
+	unknown     INTEGER NOT NULL
+);
+CREATE TABLE IF NOT EXISTS host_observations (
+	scan_id  INTEGER NOT NULL REFERENCES scans (id),
+	ip       TEXT NOT NULL,
+	status   TEXT NOT NULL,
+	rtt_ms   REAL,
+	hostname TEXT,
+	macs     TEXT,
+	error    TEXT,
+	PRIMARY KEY (scan_id, ip)
+);
+CREATE INDEX IF NOT EXISTS host_observations_ip ON host_observations (ip, scan_id);
+`
+
+// scanDB keeps every scan and what it saw of every IP in an SQLite database,
+// for the history of an address over time.
+type scanDB struct {
+	db *sql.DB
+}
+
+// openScanDB opens the database at path, creating it and its tables if
+// needed.
+func openScanDB(path string) (*scanDB, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to open database: %w", err)
+	}
+	// Another run writing at the same time makes this one wait instead of
+	// failing.
+	if _, err := db.Exec("PRAGMA busy_timeout = 5000"); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("Unable to open database %s: %w", path, err)
+	}
+	if _, err := db.Exec(dbSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("Unable to open database %s: %w", path, err)
+	}
+	return &scanDB{db: db}, nil
+}
+
+func (d *scanDB) Close() error {
+	return d.db.Close()
+}
+
+// Record writes a scan with the observation of every IP in one transaction.
+func (d *scanDB) Record(meta ScanMeta, results []Result) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	summary := Summarize(results)
+	res, err := tx.Exec("INSERT INTO scans (started, finished, pools, hosts, used, free, unknown) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		meta.Started.UTC().Format(time.RFC3339Nano), meta.Finished.UTC().Format(time.RFC3339Nano), meta.CIDR,
+		meta.HostCount, summary.Used, summary.Free, summary.Unknown)
+	if err != nil {
+		return err
+	}
+	scanID, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	for batch := range slices.Chunk(results, dbBatchSize) {
+		var (
+			query strings.Builder
+			args  []any
+		)
+		query.WriteString("INSERT INTO host_observations (scan_id, ip, status, rtt_ms, hostname, macs, error) VALUES ")
+		for i, result := range batch {
+			if i > 0 {
+				query.WriteString(", ")
+			}
+			query.WriteString("(?, ?, ?, ?, ?, ?, ?)")
+
+			r := toJSONResult(result)
+			var rtt any
+			if result.Used {
+				rtt = r.RTTMs
+			}
+			args = append(args, scanID, r.IP, r.Status, rtt, r.Hostname, strings.Join(r.MACs, " "), r.Error)
+		}
+		if _, err := tx.Exec(query.String(), args...); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// observation is what a scan saw of an IP.
+type observation struct {
+	Time   time.Time
+	Status string
+	RTT    time.Duration
+}
+
+// History returns every observation of ip, oldest first.
+func (d *scanDB) History(ip net.IP) ([]observation, error) {
+	rows, err := d.db.Query(`SELECT s.started, o.status, o.rtt_ms FROM host_observations o
+		JOIN scans s ON s.id = o.scan_id WHERE o.ip = ? ORDER BY s.started`, ip.String())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var observations []observation
+	for rows.Next() {
+		var (
+			started string
+			o       observation
+			rtt     sql.NullFloat64
+		)
+		if err := rows.Scan(&started, &o.Status, &rtt); err != nil {
+			return nil, err
+		}
+		if o.Time, err = time.Parse(time.RFC3339Nano, started); err != nil {
+			return nil, err
+		}
+		o.RTT = time.Duration(rtt.Float64 * float64(time.Millisecond))
+		observations = append(observations, o)
+	}
+	return observations, rows.Err()
+}
+
+// writeHistory writes the timeline of an IP: a line for every run of scans
+// that saw it in the same state, e.g.
+//
+//	2024-05-01T10:00:00Z .. 2024-05-02T09:00:00Z  used    (24 scans, avg 410µs)
+func writeHistory(w io.Writer, ip net.IP, observations []observation) {
+	if len(observations) == 0 {
+		fmt.Fprintf(w, "No scan has seen %s\n", ip)
+		return
+	}
+
+	used := 0
+	for start := 0; start < len(observations); {
+		end := start
+		var total time.Duration
+		for end < len(observations) && observations[end].Status == observations[start].Status {
+			total += observations[end].RTT
+			end++
+		}
+		first, last := observations[start], observations[end-1]
+		line := fmt.Sprintf("%s .. %s  %-7s (%d scans", first.Time.Format(time.RFC3339), last.Time.Format(time.RFC3339), first.Status, end-start)
+		if first.Status == StatusUsed.String() {
+			used += end - start
+			line += fmt.Sprintf(", avg %s", (total / time.Duration(end-start)).Round(10*time.Microsecond))
+		}
+		fmt.Fprintln(w, line+")")
+		start = end
+	}
+	fmt.Fprintf(w, "%s was used in %d of %d scans\n", ip, used, len(observations))
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"math/rand"
+	"net"
+	"time"
+
+	"github.com/go-ping/ping"
+)
+
+const dryRunMaxRTT = 20 * time.Millisecond
+
+// dryRunPinger answers without sending packets: every address is free, or
+// used with a random round-trip time for the given share of addresses.
+type dryRunPinger struct {
+	count int
+	used  float64
+}
+
+func newDryRunPinger(opts Options, used float64) *dryRunPinger {
+	return &dryRunPinger{count: max(opts.Count, 1), used: used}
+}
+
+func (p *dryRunPinger) String() string {
+	return "dry run, no packets sent"
+}
+
+func (p *dryRunPinger) Ping(ctx context.Context, address net.IP, onRecv func(*ping.Packet)) (*ping.Statistics, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	ipAddr := &net.IPAddr{IP: address}
+	stats := &ping.Statistics{PacketsSent: p.count, IPAddr: ipAddr, Addr: address.String(), PacketLoss: 100}
+	if rand.Float64() >= p.used {
+		return stats, nil
+	}
+
+	rtt := time.Duration(rand.Int63n(int64(dryRunMaxRTT)))
+	for seq := 0; seq < p.count; seq++ {
+		stats.Rtts = append(stats.Rtts, rtt)
+		if onRecv != nil {
+			onRecv(&ping.Packet{Rtt: rtt, IPAddr: ipAddr, Addr: address.String(), Seq: seq})
+		}
+	}
+	stats.PacketsRecv = p.count
+	stats.PacketLoss = 0
+	stats.MinRtt, stats.MaxRtt, stats.AvgRtt = rtt, rtt, rtt
+
+	return stats, nil
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// rescanLoop repeats a scan every interval. It is shared by -every and
+// -watch, which differ only in what they make of each scan.
+type rescanLoop struct {
+	analyzer *Analyzer
+	interval time.Duration
+
+	// onChange, when set, is called for every host that went from used to
+	// free or back since the scan before. Hosts whose probe failed or was cut
+	// off by -deadline keep their last known state.
+	onChange func(statusChange)
+
+	// showAll, when set, asks for show to be called with the results of the
+	// last scan while waiting for the next one.
+	showAll <-chan struct{}
+	show    func(last []Result) error
+}
+
+// run calls scan with the results of the scan before, nil the first time,
+// until ctx is done, the process is interrupted between two scans, or a scan
+// fails or is stopped with Analyzer.Stop, and returns the results of the last
+// scan. SIGHUP between two scans makes the next one look up hostnames again
+// rather than reuse those of earlier scans.
+func (l rescanLoop) run(ctx context.Context, scan func(previous []Result) ([]Result, error)) ([]Result, error) {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	defer signal.Stop(hangup)
+
+	var (
+		last   []Result
+		states map[string]bool
+	)
+	for {
+		results, err := scan(last)
+		if err != nil {
+			return results, err
+		}
+		states = l.compare(states, results)
+		last = results
+		if l.analyzer.Stopped() {
+			return last, nil
+		}
+		if again, err := l.wait(ctx, hangup, last); !again || err != nil {
+			return last, err
+		}
+	}
+}
+
+// compare calls onChange for every host of results whose status differs from
+// states, those of the scans before, and returns the status of every host
+// after results.
+func (l rescanLoop) compare(states map[string]bool, results []Result) map[string]bool {
+	now := time.Now()
+	current := make(map[string]bool, len(results))
+	for _, result := range visibleResults(results, displayOptions{}) {
+		ip := result.IP.String()
+		used, seen := states[ip]
+		if result.Err != nil && seen {
+			current[ip] = used
+			continue
+		}
+		current[ip] = result.Used
+		if seen && result.Err == nil && used != result.Used && l.onChange != nil {
+			l.onChange(statusChange{IP: ip, Old: usedText(used), New: usedText(result.Used), Time: now})
+		}
+	}
+	return current
+}
+
+// wait waits for the next scan and reports whether it is due, or false if ctx
+// is done or the process was interrupted before. Signals are only caught while
+// waiting, so that a scan can handle them on its own.
+func (l rescanLoop) wait(ctx context.Context, hangup <-chan os.Signal, last []Result) (bool, error) {
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	next := time.NewTimer(l.interval)
+	defer next.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return false, nil
+		case <-l.showAll:
+			if err := l.show(last); err != nil {
+				return false, err
+			}
+		case <-hangup:
+			l.analyzer.ClearHostnames()
+			logger.Info("hostname cache cleared")
+		case <-next.C:
+			return true, nil
+		}
+	}
+}
+
+// runEvery scans targets every interval until the process is interrupted and
+// writes every scan in format as runHeadless does, so JSON gives a document
+// per scan. Results mark the hosts that changed since the scan before. Blank
+// lines separate the scans, except with jsonl. A scan that was interrupted
+// is the last one. onChange, when set, is called for every host that changed.
+func runEvery(w io.Writer, analyzer *Analyzer, targets []string, format string, interval time.Duration, display displayOptions, onChange func(statusChange)) ([]Result, error) {
+	loop := rescanLoop{analyzer: analyzer, interval: interval, onChange: onChange}
+	return loop.run(context.Background(), func(previous []Result) ([]Result, error) {
+		if previous != nil && format != "jsonl" {
+			fmt.Fprintln(w)
+		}
+		return runHeadless(w, analyzer, targets, format, display, previous)
+	})
+}
+
+// markChanges sets Result.Changed of the results that are used but were free
+// in previous, the results of the scan before, or the other way round. Hosts
+// whose probe failed in either scan are left alone.
+func markChanges(previous, results []Result) {
+	if previous == nil {
+		return
+	}
+	before := make(map[string]Result, len(previous))
+	for _, result := range previous {
+		before[result.IP.String()] = result
+	}
+	for i, result := range results {
+		old, seen := before[result.IP.String()]
+		if seen && old.Err == nil && result.Err == nil && old.Used != result.Used {
+			results[i].Changed = true
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestRescanLoop(t *testing.T) {
+	scans := [][]Result{
+		{{IP: net.ParseIP("10.0.0.1"), Used: true}, {IP: net.ParseIP("10.0.0.2")}, {IP: net.ParseIP("10.0.0.3"), Used: true}},
+		{{IP: net.ParseIP("10.0.0.1")}, {IP: net.ParseIP("10.0.0.2"), Used: true}, {IP: net.ParseIP("10.0.0.3"), Err: errHostTimeout}},
+		{{IP: net.ParseIP("10.0.0.1")}, {IP: net.ParseIP("10.0.0.2"), Used: true}, {IP: net.ParseIP("10.0.0.3"), Used: true}},
+		{{IP: net.ParseIP("10.0.0.1")}, {IP: net.ParseIP("10.0.0.2")}, {IP: net.ParseIP("10.0.0.3")}},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var (
+		changes  []string
+		previous [][]Result
+	)
+	loop := rescanLoop{
+		analyzer: NewAnalizer(Options{}),
+		interval: time.Millisecond,
+		onChange: func(change statusChange) {
+			changes = append(changes, change.IP+" "+change.Old+" -> "+change.New)
+		},
+	}
+	last, err := loop.run(ctx, func(p []Result) ([]Result, error) {
+		previous = append(previous, p)
+		if len(previous) == len(scans) {
+			cancel()
+		}
+		return scans[len(previous)-1], nil
+	})
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if len(previous) != len(scans) || previous[0] != nil || &previous[2][0] != &scans[1][0] {
+		t.Errorf("scans were passed %v as the results before", previous)
+	}
+	if len(last) == 0 || &last[0] != &scans[3][0] {
+		t.Errorf("run returned %v, want the last scan", last)
+	}
+
+	// 10.0.0.3 timed out in the second scan and keeps its state, so it did
+	// not change until the last scan.
+	want := []string{
+		"10.0.0.1 used -> free",
+		"10.0.0.2 free -> used",
+		"10.0.0.2 used -> free",
+		"10.0.0.3 used -> free",
+	}
+	if !slices.Equal(changes, want) {
+		t.Errorf("changes = %q, want %q", changes, want)
+	}
+}
+
+func TestRescanLoopError(t *testing.T) {
+	scanErr := errors.New("no such interface")
+	scans := 0
+	loop := rescanLoop{analyzer: NewAnalizer(Options{}), interval: time.Millisecond}
+	_, err := loop.run(context.Background(), func([]Result) ([]Result, error) {
+		scans++
+		return nil, scanErr
+	})
+	if !errors.Is(err, scanErr) || scans != 1 {
+		t.Errorf("run failed with %v after %d scans, want %v after 1", err, scans, scanErr)
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+)
+
+// readExpected reads the IPs that are expected to be used, one per line.
+// Blank lines and everything after a # are ignored.
+func readExpected(path string) ([]net.IP, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read expected hosts: %w", err)
+	}
+	defer f.Close()
+
+	var ips []net.IP
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text, _, _ := strings.Cut(scanner.Text(), "#")
+		text = strings.TrimSpace(text)
+		if text == "" {
+			continue
+		}
+		ip := net.ParseIP(text)
+		if ip == nil {
+			return nil, fmt.Errorf("Invalid IP %q in %s, line %d", text, path, line)
+		}
+		ips = append(ips, ip)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("Unable to read expected hosts: %w", err)
+	}
+	return ips, nil
+}
+
+// compareExpected compares the used hosts of results with the expected ones.
+// unexpected are used hosts that are not expected, possibly rogue devices;
+// missing are expected hosts that were scanned and found free, possibly an
+// outage. Expected hosts outside the scanned pools are ignored. Both lists are
+// sorted.
+func compareExpected(results []Result, expected []net.IP) (unexpected, missing []net.IP) {
+	want := make(map[string]bool, len(expected))
+	for _, ip := range expected {
+		want[ip.String()] = true
+	}
+	for _, result := range visibleResults(results, displayOptions{}) {
+		switch {
+		case result.Used && !want[result.IP.String()]:
+			unexpected = append(unexpected, result.IP)
+		case result.Status() == StatusFree && want[result.IP.String()]:
+			missing = append(missing, result.IP)
+		}
+	}
+	return unexpected, missing
+}
+
+// drift reports whether results differ from the expected hosts of display.
+func (d displayOptions) drift(results []Result) bool {
+	if d.expected == nil {
+		return false
+	}
+	unexpected, missing := compareExpected(results, d.expected)
+	return len(unexpected) > 0 || len(missing) > 0
+}
+
+// writeExpectedAlerts writes a section for unexpected and for missing hosts,
+// if there are any. heading is prepended to the section titles.
+func writeExpectedAlerts(w io.Writer, results []Result, expected []net.IP, heading string) {
+	unexpected, missing := compareExpected(results, expected)
+	section := func(title string, ips []net.IP) {
+		if len(ips) == 0 {
+			return
+		}
+		fmt.Fprintf(w, "\n%s%s (%d):\n", heading, title, len(ips))
+		for _, ip := range ips {
+			fmt.Fprintf(w, "- %s\n", ip)
+		}
+	}
+	section("Unexpected used hosts, not in the expected list", unexpected)
+	section("Missing hosts, expected but free", missing)
+}
+
+func ipStrings(ips []net.IP) []string {
+	var texts []string
+	for _, ip := range ips {
+		texts = append(texts, ip.String())
+	}
+	return texts
+}
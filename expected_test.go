@@ -0,0 +1,62 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"slices"
+	"testing"
+)
+
+func TestCompareExpected(t *testing.T) {
+	results := []Result{
+		{IP: net.ParseIP("10.0.0.9"), Used: true},
+		{IP: net.ParseIP("10.0.0.1"), Used: true},
+		{IP: net.ParseIP("10.0.0.2")},
+		{IP: net.ParseIP("10.0.0.3"), Err: errors.New("no buffer space available")},
+		{IP: net.ParseIP("10.0.0.4"), Used: true},
+		{IP: net.ParseIP("10.0.0.5")},
+	}
+	tests := []struct {
+		name                string
+		expected            []string
+		unexpected, missing []string
+	}{
+		{
+			name:       "nothing expected",
+			unexpected: []string{"10.0.0.1", "10.0.0.4", "10.0.0.9"},
+		},
+		{
+			name:     "all as expected",
+			expected: []string{"10.0.0.1", "10.0.0.4", "10.0.0.9"},
+		},
+		{
+			name:       "rogue and outage",
+			expected:   []string{"10.0.0.5", "10.0.0.1", "10.0.0.2"},
+			unexpected: []string{"10.0.0.4", "10.0.0.9"},
+			missing:    []string{"10.0.0.2", "10.0.0.5"},
+		},
+		{
+			name:     "unknown hosts are not missing",
+			expected: []string{"10.0.0.1", "10.0.0.3", "10.0.0.4", "10.0.0.9"},
+		},
+		{
+			name:     "outside the pools",
+			expected: []string{"10.0.0.1", "10.0.0.4", "10.0.0.9", "192.168.1.1"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var expected []net.IP
+			for _, ip := range tt.expected {
+				expected = append(expected, net.ParseIP(ip))
+			}
+			unexpected, missing := compareExpected(results, expected)
+			if got := ipStrings(unexpected); !slices.Equal(got, tt.unexpected) {
+				t.Errorf("unexpected = %v, want %v", got, tt.unexpected)
+			}
+			if got := ipStrings(missing); !slices.Equal(got, tt.missing) {
+				t.Errorf("missing = %v, want %v", got, tt.missing)
+			}
+		})
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+)
+
+// grepableTime is the time format of the comments of nmap's grepable output,
+// that of ctime.
+const grepableTime = "Mon Jan _2 15:04:05 2006"
+
+// grepableStatus maps the status of hosts to the Status field of nmap.
+// Unknown hosts have no counterpart in nmap and keep their own word.
+var grepableStatus = map[Status]string{StatusUsed: "Up", StatusFree: "Down", StatusUnknown: "Unknown"}
+
+// writeGrepable writes the results in the subset of nmap's grepable format
+// (-oG) that parsers of host discovery rely on: a Status line per IP such as
+// "Host: 10.0.0.5 (printer.lan)\tStatus: Up", a Ports line for IPs probed with
+// -tcp, and comment lines at the start and end unless quiet.
+func writeGrepable(w io.Writer, meta ScanMeta, results []Result, display displayOptions) error {
+	if !display.quiet {
+		fmt.Fprintf(w, "# ipdefiner %s scan initiated %s as: %s\n", version, meta.Started.Format(grepableTime), strings.Join(os.Args, " "))
+	}
+	for _, result := range visibleResults(results, display) {
+		// Tabs separate the fields, so names must not hold any.
+		host := fmt.Sprintf("Host: %s (%s)", result.IP, strings.ReplaceAll(result.Hostname, "\t", " "))
+		if _, err := fmt.Fprintf(w, "%s\tStatus: %s\n", host, grepableStatus[result.Status()]); err != nil {
+			return err
+		}
+		if len(result.Ports) == 0 {
+			continue
+		}
+		var ports []string
+		for _, port := range slices.Sorted(maps.Keys(result.Ports)) {
+			ports = append(ports, fmt.Sprintf("%d/%s/tcp/////", port, result.Ports[port]))
+		}
+		if _, err := fmt.Fprintf(w, "%s\tPorts: %s\n", host, strings.Join(ports, ", ")); err != nil {
+			return err
+		}
+	}
+	if display.quiet {
+		return nil
+	}
+	_, err := fmt.Fprintf(w, "# ipdefiner done at %s -- %d IP addresses (%d hosts up) scanned in %.2f seconds%s\n",
+		meta.Finished.Format(grepableTime), meta.HostCount, Summarize(results).Used, meta.Duration.Seconds(), deadlineNote(meta))
+	return err
+}
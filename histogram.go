@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"time"
+)
+
+const histogramBarWidth = 40
+
+type Bucket struct {
+	Label string        `json:"label"`
+	Min   time.Duration `json:"-"`
+	Max   time.Duration `json:"-"`
+	Count int           `json:"count"`
+}
+
+var histogramBounds = []struct {
+	label    string
+	min, max time.Duration
+}{
+	{"<1ms", 0, time.Millisecond},
+	{"1-5ms", time.Millisecond, 5 * time.Millisecond},
+	{"5-20ms", 5 * time.Millisecond, 20 * time.Millisecond},
+	{"20-100ms", 20 * time.Millisecond, 100 * time.Millisecond},
+	{">100ms", 100 * time.Millisecond, time.Duration(math.MaxInt64)},
+}
+
+// Histogram buckets the round-trip times of used hosts. Free hosts have no
+// round-trip time and are not counted.
+func Histogram(results []Result) []Bucket {
+	buckets := make([]Bucket, len(histogramBounds))
+	for i, bound := range histogramBounds {
+		buckets[i] = Bucket{Label: bound.label, Min: bound.min, Max: bound.max}
+	}
+
+	for _, result := range results {
+		if !result.Used {
+			continue
+		}
+		for i := range buckets {
+			if result.RTT >= buckets[i].Min && result.RTT < buckets[i].Max {
+				buckets[i].Count++
+				break
+			}
+		}
+	}
+
+	return buckets
+}
+
+func writeHistogramBars(w io.Writer, buckets []Bucket) {
+	largest := 0
+	for _, bucket := range buckets {
+		largest = max(largest, bucket.Count)
+	}
+
+	for _, bucket := range buckets {
+		width := 0
+		if largest > 0 {
+			width = bucket.Count * histogramBarWidth / largest
+		}
+		if bucket.Count > 0 && width == 0 {
+			width = 1
+		}
+		fmt.Fprintf(w, "%-9s %s %d\n", bucket.Label, strings.Repeat("█", width), bucket.Count)
+	}
+}
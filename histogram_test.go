@@ -0,0 +1,53 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHistogramBucketBoundaries(t *testing.T) {
+	tests := []struct {
+		rtt    time.Duration
+		bucket string
+	}{
+		{0, "<1ms"},
+		{time.Millisecond - 1, "<1ms"},
+		{time.Millisecond, "1-5ms"},
+		{5*time.Millisecond - 1, "1-5ms"},
+		{5 * time.Millisecond, "5-20ms"},
+		{20 * time.Millisecond, "20-100ms"},
+		{100*time.Millisecond - 1, "20-100ms"},
+		{100 * time.Millisecond, ">100ms"},
+		{time.Minute, ">100ms"},
+	}
+	for _, tt := range tests {
+		buckets := Histogram([]Result{{Used: true, RTT: tt.rtt}})
+		for _, bucket := range buckets {
+			want := 0
+			if bucket.Label == tt.bucket {
+				want = 1
+			}
+			if bucket.Count != want {
+				t.Errorf("Histogram(%s): bucket %s has %d hosts, want %d", tt.rtt, bucket.Label, bucket.Count, want)
+			}
+		}
+	}
+}
+
+func TestHistogramSkipsFreeHosts(t *testing.T) {
+	buckets := Histogram([]Result{
+		{Used: true, RTT: 2 * time.Millisecond},
+		{Used: false},
+		{Used: true, RTT: 3 * time.Millisecond},
+	})
+	total := 0
+	for _, bucket := range buckets {
+		total += bucket.Count
+	}
+	if total != 2 {
+		t.Errorf("Histogram counted %d hosts, want 2", total)
+	}
+	if buckets[1].Count != 2 {
+		t.Errorf("bucket %s has %d hosts, want 2", buckets[1].Label, buckets[1].Count)
+	}
+}
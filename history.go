@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// maxHistory is the number of entries the input history keeps.
+const maxHistory = 100
+
+// targetHistory keeps the pools entered in the input field, oldest first, so
+// that they can be recalled with the arrow keys in later runs.
+type targetHistory interface {
+	Load() ([]string, error)
+	Save(entries []string) error
+}
+
+// fileHistory keeps the history in a file, one entry per line.
+type fileHistory struct {
+	path string
+}
+
+// memoryHistory keeps the history for as long as the program runs, where there
+// is no cache directory to keep it in.
+type memoryHistory struct {
+	entries []string
+}
+
+func (h *memoryHistory) Load() ([]string, error) {
+	return slices.Clone(h.entries), nil
+}
+
+func (h *memoryHistory) Save(entries []string) error {
+	h.entries = slices.Clone(entries)
+	return nil
+}
+
+// defaultHistoryPath returns the file the input history is kept in, or an
+// empty string if there is no cache directory.
+func defaultHistoryPath() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "ipdefiner", "history")
+}
+
+// Load returns the entries of the file. A missing file is an empty history.
+func (h fileHistory) Load() ([]string, error) {
+	data, err := os.ReadFile(h.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var entries []string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			entries = append(entries, line)
+		}
+	}
+	return entries, scanner.Err()
+}
+
+func (h fileHistory) Save(entries []string) error {
+	if err := os.MkdirAll(filepath.Dir(h.path), 0o755); err != nil {
+		return err
+	}
+	var b strings.Builder
+	for _, entry := range entries {
+		b.WriteString(entry + "\n")
+	}
+	return os.WriteFile(h.path, []byte(b.String()), 0o644)
+}
+
+// addToHistory returns entries with entry moved or added to the end, keeping
+// at most maxHistory of the newest entries.
+func addToHistory(entries []string, entry string) []string {
+	entries = slices.DeleteFunc(slices.Clone(entries), func(e string) bool { return e == entry })
+	entries = append(entries, entry)
+	return entries[max(len(entries)-maxHistory, 0):]
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestHistoryRoundTrip(t *testing.T) {
+	stores := []struct {
+		name    string
+		history func(t *testing.T) targetHistory
+	}{
+		{"file", func(t *testing.T) targetHistory {
+			return fileHistory{path: filepath.Join(t.TempDir(), "ipdefiner", "history")}
+		}},
+		{"memory", func(t *testing.T) targetHistory {
+			return &memoryHistory{}
+		}},
+	}
+	for _, store := range stores {
+		t.Run(store.name, func(t *testing.T) {
+			history := store.history(t)
+			entries, err := history.Load()
+			if err != nil || len(entries) != 0 {
+				t.Fatalf("Load of a new history = %v, %v, want nothing", entries, err)
+			}
+
+			var want []string
+			for _, entry := range []string{"10.0.0.0/24", "192.168.1.0/24 fd00::/120", "10.0.0.0/24"} {
+				want = addToHistory(want, entry)
+				if err := history.Save(want); err != nil {
+					t.Fatalf("Save: %v", err)
+				}
+			}
+			entries, err = history.Load()
+			if err != nil {
+				t.Fatalf("Load: %v", err)
+			}
+			if !slices.Equal(entries, want) {
+				t.Errorf("Load = %q, want %q", entries, want)
+			}
+
+			// The loaded entries are a copy.
+			entries[0] = "changed"
+			if entries, _ := history.Load(); !slices.Equal(entries, want) {
+				t.Errorf("Load after changing its result = %q, want %q", entries, want)
+			}
+		})
+	}
+}
+
+func TestFileHistorySkipsBlankLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history")
+	if err := os.WriteFile(path, []byte("10.0.0.0/24\n\n  \n 10.0.1.0/24 \n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := fileHistory{path: path}.Load()
+	if want := []string{"10.0.0.0/24", "10.0.1.0/24"}; err != nil || !slices.Equal(entries, want) {
+		t.Errorf("Load = %q, %v, want %q", entries, err, want)
+	}
+}
+
+func TestAddToHistory(t *testing.T) {
+	var entries []string
+	for i := range maxHistory + 5 {
+		entries = addToHistory(entries, fmt.Sprintf("10.0.%d.0/24", i))
+	}
+	entries = addToHistory(entries, "10.0.50.0/24")
+	if len(entries) != maxHistory {
+		t.Fatalf("%d entries kept, want %d", len(entries), maxHistory)
+	}
+	if entries[0] != "10.0.5.0/24" || entries[len(entries)-1] != "10.0.50.0/24" {
+		t.Errorf("entries run from %s to %s, want 10.0.5.0/24 to 10.0.50.0/24", entries[0], entries[len(entries)-1])
+	}
+	if slices.Index(entries, "10.0.50.0/24") != len(entries)-1 {
+		t.Error("a repeated entry was kept twice")
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"html/template"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+var reportTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>IP address analyzer: {{.Meta.CIDR}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; color: #222; }
+table { border-collapse: collapse; }
+th, td { padding: 4px 12px; border-bottom: 1px solid #ddd; text-align: left; }
+th { cursor: pointer; user-select: none; background: #f4f4f4; }
+.used { color: #1a7f37; font-weight: bold; }
+.free { color: #cf222e; }
+.conflict { color: #9a6700; font-weight: bold; }
+.unknown { color: #6e7781; }
+</style>
+</head>
+<body>
+<h1>IP address analyzer</h1>
+<p>Analyzed address pool: <strong>{{.Meta.CIDR}}</strong><br>
+Scanned {{.Meta.HostCount}} addresses at {{.Meta.Started.Format "2006-01-02 15:04:05 MST"}} in {{.Meta.Duration.Round 1000000}}</p>
+<p>{{.Summary.Used}} used, {{.Summary.Free}} free of {{.Summary.Total}} addresses
+{{- if .Summary.Unknown}}, {{.Summary.Unknown}} unknown{{end}}
+{{- if .Summary.Conflicts}}, {{.Summary.Conflicts}} in conflict{{end}}.</p>
+<table id="results">
+<thead>
+<tr><th>IP</th><th>Status</th><th>Hostname</th><th>RTT (ms)</th><th>MAC</th><th>Note</th><th>Error</th></tr>
+</thead>
+<tbody>
+{{- range .Rows}}
+<tr>
+<td data-key="{{.IPKey}}">{{.IP}}</td>
+<td class="{{.Status}}">{{.Status}}</td>
+<td>{{.Hostname}}</td>
+<td data-key="{{.RTTMs}}">{{if .Used}}{{printf "%.2f" .RTTMs}}{{end}}</td>
+<td>{{.MACs}}</td>
+<td>{{.Note}}</td>
+<td>{{.Error}}</td>
+</tr>
+{{- end}}
+</tbody>
+</table>
+<script>
+document.querySelectorAll("#results th").forEach(function (th, column) {
+  var ascending = true;
+  th.addEventListener("click", function () {
+    var body = document.querySelector("#results tbody");
+    var rows = Array.from(body.rows);
+    rows.sort(function (a, b) {
+      var x = a.cells[column], y = b.cells[column];
+      var kx = x.dataset.key !== undefined ? x.dataset.key : x.textContent;
+      var ky = y.dataset.key !== undefined ? y.dataset.key : y.textContent;
+      var nx = parseFloat(kx), ny = parseFloat(ky);
+      var order = !isNaN(nx) && !isNaN(ny) && column !== 0 ? nx - ny : kx.localeCompare(ky);
+      return ascending ? order : -order;
+    });
+    rows.forEach(function (row) { body.appendChild(row); });
+    ascending = !ascending;
+  });
+});
+</script>
+</body>
+</html>
+`))
+
+type reportRow struct {
+	IP       string
+	IPKey    string
+	Status   string
+	Used     bool
+	Hostname string
+	RTTMs    float64
+	MACs     string
+	Note     string
+	Error    string
+}
+
+type reportData struct {
+	Meta    ScanMeta
+	Summary Summary
+	Rows    []reportRow
+}
+
+func writeHTMLFile(path string, meta ScanMeta, results []Result, display displayOptions) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("Unable to write HTML report: %w", err)
+	}
+	defer f.Close()
+
+	if err := writeHTML(f, meta, results, display); err != nil {
+		return fmt.Errorf("Unable to write HTML report: %w", err)
+	}
+
+	return f.Close()
+}
+
+func writeHTML(w io.Writer, meta ScanMeta, results []Result, display displayOptions) error {
+	data := reportData{
+		Meta:    meta,
+		Summary: Summarize(results),
+	}
+
+	for _, result := range visibleResults(results, display) {
+		row := reportRow{
+			IP:       result.IP.String(),
+			IPKey:    hex.EncodeToString(result.IP.To16()),
+			Status:   statusText(result),
+			Used:     result.Used,
+			Hostname: result.Hostname,
+			Note:     result.Note,
+			RTTMs:    float64(result.RTT) / float64(time.Millisecond),
+		}
+		var macs []string
+		for _, mac := range result.MACs {
+			macs = append(macs, mac.String())
+		}
+		row.MACs = strings.Join(macs, ", ")
+		if result.Err != nil {
+			row.Error = result.Err.Error()
+		}
+		data.Rows = append(data.Rows, row)
+	}
+
+	return reportTemplate.Execute(w, data)
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"net"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/go-ping/ping"
+)
+
+// ifacePinger pings every host from several interfaces at the same time, each
+// with a pinger of its own, and remembers which interfaces got an answer. The
+// statistics of the interface with the most replies stand for the host.
+type ifacePinger struct {
+	names   []string
+	pingers []Pinger
+
+	mu       sync.Mutex
+	answered map[string]map[string]bool
+	sent     map[string]int
+}
+
+// newIfacePinger builds a pinger for every interface of opts.Interfaces.
+func newIfacePinger(opts Options) *ifacePinger {
+	p := &ifacePinger{answered: make(map[string]map[string]bool), sent: make(map[string]int)}
+	for _, name := range opts.Interfaces {
+		single := opts
+		single.Interface, single.Interfaces = name, nil
+		p.names = append(p.names, name)
+		p.pingers = append(p.pingers, newPinger(single))
+	}
+	return p
+}
+
+func (p *ifacePinger) Ping(ctx context.Context, address net.IP, onRecv func(*ping.Packet)) (*ping.Statistics, error) {
+	var (
+		mu    sync.Mutex
+		wg    sync.WaitGroup
+		stats = make([]*ping.Statistics, len(p.pingers))
+		errs  = make([]error, len(p.pingers))
+	)
+	// The callers' onRecv does not expect concurrent calls.
+	recv := func(packet *ping.Packet) {
+		mu.Lock()
+		defer mu.Unlock()
+		if onRecv != nil {
+			onRecv(packet)
+		}
+	}
+	for i, pinger := range p.pingers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			stats[i], errs[i] = pinger.Ping(ctx, address, recv)
+		}()
+	}
+	wg.Wait()
+
+	var (
+		best     *ping.Statistics
+		sent     int
+		firstErr error
+		answered = make(map[string]bool)
+	)
+	for i, name := range p.names {
+		// Every pinger forgets the traffic, but like the packets only that
+		// of the best interface is reported.
+		bytes := countBytes(p.pingers[i], address, stats[i])
+		if errs[i] != nil {
+			if isSetupError(errs[i]) {
+				return nil, errs[i]
+			}
+			// The host cannot be reached from this interface at all.
+			logger.Debug("probe failed", "ip", address, "iface", name, "err", errs[i])
+			firstErr = cmp.Or(firstErr, errs[i])
+			answered[name] = false
+			continue
+		}
+		if stats[i] == nil {
+			continue
+		}
+		answered[name] = stats[i].PacketsRecv > 0
+		if best == nil || stats[i].PacketsRecv > best.PacketsRecv {
+			best, sent = stats[i], bytes
+		}
+	}
+	if best == nil {
+		return nil, firstErr
+	}
+
+	p.mu.Lock()
+	p.answered[address.String()] = answered
+	p.sent[address.String()] = sent
+	p.mu.Unlock()
+	return best, nil
+}
+
+func (p *ifacePinger) bytesSent(ip net.IP, _ *ping.Statistics) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	sent := p.sent[ip.String()]
+	delete(p.sent, ip.String())
+	return sent
+}
+
+func (p *ifacePinger) addDetails(result *Result) {
+	p.mu.Lock()
+	result.Interfaces = p.answered[result.IP.String()]
+	delete(p.answered, result.IP.String())
+	p.mu.Unlock()
+
+	for _, pinger := range p.pingers {
+		if detailer, ok := pinger.(hostDetailer); ok {
+			detailer.addDetails(result)
+		}
+	}
+}
+
+// mismatchWarning is the warning about the addresses that answered on some
+// interfaces only.
+func mismatchWarning(mismatches int) string {
+	return fmt.Sprintf("Interfaces disagree: %d IPs answer on some interfaces but not on others", mismatches)
+}
+
+// parseInterfaces splits a comma separated list of interface names.
+func parseInterfaces(s string) []string {
+	var names []string
+	for _, name := range strings.Split(s, ",") {
+		if name = strings.TrimSpace(name); name != "" && !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// answeredOn returns the sorted names of the interfaces result got an answer
+// on.
+func answeredOn(result Result) []string {
+	var names []string
+	for name, answered := range result.Interfaces {
+		if answered {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// interfaceNames returns the sorted names of all interfaces in results.
+func interfaceNames(results []Result) []string {
+	var names []string
+	for _, result := range results {
+		for name := range result.Interfaces {
+			if !slices.Contains(names, name) {
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,108 @@
+// Package fakenet provides a deterministic stand-in for the network so the
+// scanner can be exercised without sending real packets.
+package fakenet
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/go-ping/ping"
+)
+
+// Host describes how a live address answers.
+type Host struct {
+	RTT time.Duration
+
+	// Lost is the number of echo requests per ping that get no reply.
+	Lost int
+}
+
+// Network answers pings for the hosts added to it and leaves every other
+// address silent. It is safe for concurrent use.
+type Network struct {
+	// Count is the number of echo requests sent per ping.
+	Count int
+
+	mu     sync.Mutex
+	hosts  map[string]Host
+	errs   map[string]error
+	pinged []net.IP
+}
+
+func New() *Network {
+	return &Network{
+		Count: 2,
+		hosts: make(map[string]Host),
+		errs:  make(map[string]error),
+	}
+}
+
+// AddHost makes ip answer every echo request after rtt.
+func (n *Network) AddHost(ip string, rtt time.Duration) {
+	n.SetHost(ip, Host{RTT: rtt})
+}
+
+func (n *Network) SetHost(ip string, host Host) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.hosts[key(ip)] = host
+}
+
+// Fail makes every ping of ip return err.
+func (n *Network) Fail(ip string, err error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.errs[key(ip)] = err
+}
+
+// Pinged returns the addresses pinged so far, in the order the pings started.
+func (n *Network) Pinged() []net.IP {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return append([]net.IP(nil), n.pinged...)
+}
+
+func (n *Network) Ping(ctx context.Context, ip net.IP, onRecv func(*ping.Packet)) (*ping.Statistics, error) {
+	n.mu.Lock()
+	n.pinged = append(n.pinged, ip)
+	host, live := n.hosts[ip.String()]
+	err := n.errs[ip.String()]
+	n.mu.Unlock()
+
+	if err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	ipAddr := &net.IPAddr{IP: ip}
+	stats := &ping.Statistics{
+		PacketsSent: n.Count,
+		IPAddr:      ipAddr,
+		Addr:        ip.String(),
+	}
+	if live {
+		for seq := 0; seq < n.Count-host.Lost; seq++ {
+			stats.PacketsRecv++
+			stats.Rtts = append(stats.Rtts, host.RTT)
+			if onRecv != nil {
+				onRecv(&ping.Packet{Rtt: host.RTT, IPAddr: ipAddr, Addr: ip.String(), Seq: seq})
+			}
+		}
+		if stats.PacketsRecv > 0 {
+			stats.MinRtt, stats.MaxRtt, stats.AvgRtt = host.RTT, host.RTT, host.RTT
+		}
+	}
+	if stats.PacketsSent > 0 {
+		stats.PacketLoss = float64(stats.PacketsSent-stats.PacketsRecv) / float64(stats.PacketsSent) * 100
+	}
+
+	return stats, nil
+}
+
+func key(ip string) string {
+	return net.ParseIP(ip).String()
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Lease states reported when a lease file is given.
+const (
+	leaseActive = "leased"
+	leaseStale  = "stale"
+	leaseRogue  = "rogue"
+)
+
+// Lease is an address handed out by a DHCP server. A zero Ends never expires.
+type Lease struct {
+	IP   net.IP
+	Ends time.Time
+	MAC  net.HardwareAddr
+}
+
+// Active reports whether the lease still holds at now.
+func (l Lease) Active(now time.Time) bool {
+	return l.Ends.IsZero() || l.Ends.After(now)
+}
+
+// readLeaseFile reads an ISC dhcpd lease file, see parseLeases.
+func readLeaseFile(path string) (map[string]Lease, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to open lease file: %w", err)
+	}
+	defer f.Close()
+
+	leases, err := parseLeases(f)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read lease file %s: %w", path, err)
+	}
+	return leases, nil
+}
+
+// parseLeases reads the lease declarations of an ISC dhcpd lease file, keyed by
+// IP. dhcpd appends a new declaration whenever a lease changes, so the last one
+// of an address wins. Only the ends and hardware statements are read.
+func parseLeases(r io.Reader) (map[string]Lease, error) {
+	var (
+		leases  = make(map[string]Lease)
+		current *Lease
+	)
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Fields(strings.TrimSuffix(strings.TrimSpace(scanner.Text()), ";"))
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+
+		switch {
+		case fields[0] == "lease" && len(fields) >= 2:
+			ip := net.ParseIP(fields[1])
+			if ip == nil {
+				return nil, fmt.Errorf("line %d: invalid address %q", line, fields[1])
+			}
+			current = &Lease{IP: ip}
+		case current == nil:
+		case fields[0] == "}":
+			leases[current.IP.String()] = *current
+			current = nil
+		case fields[0] == "ends":
+			ends, err := parseLeaseTime(fields[1:])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", line, err)
+			}
+			current.Ends = ends
+		case fields[0] == "hardware" && len(fields) >= 3:
+			mac, err := net.ParseMAC(fields[2])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", line, err)
+			}
+			current.MAC = mac
+		}
+	}
+	return leases, scanner.Err()
+}
+
+// parseLeaseTime parses the arguments of an ends statement: "never",
+// "epoch <seconds>" or "<weekday> <yyyy/mm/dd> <hh:mm:ss>" in UTC.
+func parseLeaseTime(args []string) (time.Time, error) {
+	switch {
+	case len(args) == 1 && args[0] == "never":
+		return time.Time{}, nil
+	case len(args) >= 2 && args[0] == "epoch":
+		seconds, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid lease time %q", args[1])
+		}
+		return time.Unix(seconds, 0), nil
+	case len(args) >= 3:
+		t, err := time.Parse("2006/01/02 15:04:05", args[1]+" "+args[2])
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid lease time %q", strings.Join(args, " "))
+		}
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid lease time %q", strings.Join(args, " "))
+}
+
+// leaseState compares a result with the leases: an active lease for a used IP
+// is leased, for a free IP it is stale, and a used IP without an active lease
+// is rogue. Free IPs without a lease have no state.
+func leaseState(result Result, leases map[string]Lease, now time.Time) string {
+	lease, ok := leases[result.IP.String()]
+	leased := ok && lease.Active(now)
+	switch {
+	case leased && result.Used:
+		return leaseActive
+	case leased:
+		return leaseStale
+	case result.Used:
+		return leaseRogue
+	}
+	return ""
+}
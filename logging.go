@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+)
+
+var logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+func setupLogger(level, file string) (func(), error) {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf("Invalid log level: %s", level)
+	}
+
+	var w io.Writer = io.Discard
+	closeLog := func() {}
+	if file != "" {
+		f, err := os.OpenFile(file, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to open log file: %w", err)
+		}
+		w = f
+		closeLog = func() { f.Close() }
+	}
+
+	logger = slog.New(slog.NewTextHandler(w, &slog.HandlerOptions{Level: lvl}))
+
+	return closeLog, nil
+}
+
+type pingLogger struct{}
+
+func (pingLogger) Fatalf(format string, v ...interface{}) {
+	logger.Error(fmt.Sprintf(format, v...))
+}
+
+func (pingLogger) Errorf(format string, v ...interface{}) {
+	logger.Error(fmt.Sprintf(format, v...))
+}
+
+func (pingLogger) Warnf(format string, v ...interface{}) {
+	logger.Warn(fmt.Sprintf(format, v...))
+}
+
+func (pingLogger) Infof(format string, v ...interface{}) {
+	logger.Info(fmt.Sprintf(format, v...))
+}
+
+func (pingLogger) Debugf(format string, v ...interface{}) {
+	logger.Debug(fmt.Sprintf(format, v...))
+}
@@ -1,189 +1,822 @@
 package main
 
 import (
-	"bytes"
+	"flag"
 	"fmt"
 	"log"
-	"math"
 	"net"
 	"os"
+	"slices"
 	"sort"
-	"sync"
+	"strings"
 	"time"
+	"unicode/utf8"
 
-	"github.com/gdamore/tcell/v2"
-	"github.com/go-ping/ping"
-	"github.com/rivo/tview"
 	"github.com/samber/lo"
 )
 
 const (
-	numColumns            = 4
-	columntPadding        = 15
-	paddingBetweenIpState = 15
-	inputFieldWidth       = 20
+	numColumns      = 4
+	columnSeparator = "    "
+	maxNameWidth    = 32
+	inputFieldWidth = 20
+
+	minPingSize = 24
+	maxPingSize = 65507
+)
+
+// Exit codes, so that scripts can branch on the outcome of a scan.
+const (
+	exitUsed        = 0   // the scan finished and at least one IP is used
+	exitAllFree     = 1   // the scan finished and every IP is free
+	exitSetupError  = 2   // invalid arguments or the scan could not run
+	exitDrift       = 3   // with -fail-on-drift, the used IPs differ from -expected
+	exitUnknown     = 4   // the scan finished, no IP is used and some could not be probed
+	exitInterrupted = 130 // the scan was interrupted; the results so far were written
 )
 
 func main() {
-	var showOnlyUsedIPs bool
+	var (
+		display     displayOptions
+		pingSize    int
+		timeout     time.Duration
+		hostTimeout time.Duration
+		deadline    time.Duration
+		warmup      time.Duration
+		workers     int
+		autoWorkers bool
+		count       int
+		interval    time.Duration
+		adaptive    bool
+		priority    bool
+		shuffle     bool
+		shuffleSeed int64
+		failFast    bool
+		iface       string
+		arp         bool
+		nd          bool
+		resolve     bool
+		dnsServer   string
+		dnsTimeout  time.Duration
+		leaseFile   string
+		compareFile string
+		excludes    stringList
+		cidrs       stringList
+		local       bool
+		dryRun      bool
+		dryRunUsed  float64
+		udpPort     int
+		icmpMode    string
+		tcpPorts    string
+		banner      bool
+		withICMP    bool
+		requireAll  bool
+		maxLoss     float64
+		unreachable bool
+		mdns        bool
+		netbios     bool
+		community   string
+		expected    string
+		failOnDrift bool
+		enum        EnumOptions
+		logLevel    string
+		logFile     string
+		format      string
+		ndjson      bool
+		aggregated  bool
+		summaryOnly bool
+		rollup      bool
+		serveAddr   string
+		metricsAddr string
+		textfile    string
+		outputDir   string
+		watch       time.Duration
+		every       time.Duration
+		webhookURL  string
+		showVersion bool
+		configPath  string
+		noColor     bool
+		cacheTTL    time.Duration
+		cacheFile   string
+		notesFile   string
+		dbPath      string
+		history     string
+		noCache     bool
+		colors      string
+		themeName   string
+	)
+
+	flag.BoolVar(&display.onlyUsed, "u", false, "show only IPs that are in use")
+	flag.BoolVar(&display.quiet, "quiet", false, "print only the data rows, without headers or progress (errors still go to stderr)")
+	flag.BoolVar(&display.hist, "hist", false, "show a histogram of round-trip times of used IPs")
+	flag.IntVar(&pingSize, "size", minPingSize, "size of the ICMP payload in bytes")
+	flag.DurationVar(&timeout, "timeout", 5*time.Second, "how long to wait for replies from a single IP")
+	flag.DurationVar(&warmup, "warmup", 0, "probe the IPs that did not answer once more after this delay, for devices that wake up on the first probe")
+	flag.DurationVar(&deadline, "deadline", 0, "stop the scan after this long and report the IPs not probed by then as not scanned (0 for no limit)")
+	flag.DurationVar(&hostTimeout, "host-timeout", 0, "give up on an IP after this long, name lookups included, and report it as unknown (0 for no limit)")
+	flag.BoolVar(&priority, "priority", false, "probe the first and last host and common gateway addresses before the rest")
+	flag.BoolVar(&shuffle, "shuffle", false, "probe the addresses in random order instead of ascending, to spread the traffic over the pool")
+	flag.BoolVar(&failFast, "fail-fast", false, "abort the scan at the first IP whose probe fails instead of reporting it as unknown")
+	flag.Int64Var(&shuffleSeed, "shuffle-seed", 0, "with -shuffle, seed of the random order, to repeat a scan in the same order (0 for a new order every time)")
+	flag.BoolVar(&adaptive, "adaptive", false, "shorten the timeout to a multiple of the median round-trip time once enough IPs have answered")
+	flag.IntVar(&count, "count", 2, "number of echo requests (or UDP attempts) per IP")
+	flag.DurationVar(&interval, "interval", time.Second, "time between the echo requests to an IP (0 to send them all at once)")
+	flag.Float64Var(&maxLoss, "max-loss", 100, "count an IP as used only if it lost less than this percentage of the probes, and as unknown if it lost more but not all")
+	flag.BoolVar(&unreachable, "unreachable-as-free", false, "count IPs whose network or host is unreachable from here as free instead of unknown")
+	flag.IntVar(&workers, "workers", 256, "number of IPs to ping at the same time")
+	flag.BoolVar(&autoWorkers, "auto-workers", false, "start with few workers and double them up to -workers while the probes do not run out of sockets, halving them when they do")
+	flag.StringVar(&iface, "iface", "", "network interface to send pings from; several separated by commas ping from all of them and compare")
+	flag.BoolVar(&arp, "arp", false, "look up the MAC address of used IPs and flag IPs claimed by several MACs")
+	flag.BoolVar(&nd, "nd", false, "probe IPv6 addresses on directly attached links with neighbor solicitations instead, recording their MAC addresses (needs root or CAP_NET_RAW)")
+	flag.StringVar(&icmpMode, "icmp", icmpAuto, "ICMP sockets to ping with: raw (needs root or CAP_NET_RAW), unprivileged (needs net.ipv4.ping_group_range), or auto to try raw first")
+	flag.IntVar(&udpPort, "udp", 0, "probe this UDP port instead of sending pings")
+	flag.StringVar(&tcpPorts, "tcp", "", "connect to these comma separated TCP ports instead of sending pings, e.g. 22,80,443")
+	flag.BoolVar(&withICMP, "with-icmp", false, "with -tcp or -udp, send pings as well and record which probes every IP answered")
+	flag.BoolVar(&requireAll, "require-all", false, "with -tcp, count an IP as used only when every port is open, instead of when any port answers")
+	flag.BoolVar(&banner, "banner", false, "with -tcp, record what the open ports say first")
+	flag.BoolVar(&enum.IncludeNetwork, "include-network", false, "also probe the network address of each pool")
+	flag.BoolVar(&enum.IncludeBroadcast, "include-broadcast", false, "also probe the broadcast address of each IPv4 pool")
+	flag.BoolVar(&dryRun, "dry-run", false, "walk the address pools without sending packets, marking every IP free")
+	flag.Float64Var(&dryRunUsed, "dry-run-used", 0, "with -dry-run, share of IPs between 0 and 1 to mark as used at random")
+	flag.BoolVar(&local, "local", false, "scan the IPv4 subnet of the local interface, asking which one if there are several")
+	flag.Var(&cidrs, "cidr", "address pool to analyze, like the arguments (can be repeated; also IPDEFINER_CIDR)")
+	flag.Var(&excludes, "exclude", "skip the IPs of this CIDR (can be repeated)")
+	flag.StringVar(&compareFile, "compare", "", "flag IPs that answer from a different MAC than in this earlier JSON output, e.g. from another interface")
+	flag.StringVar(&expected, "expected", "", "flag used IPs missing from this list of IPs, one per line, and listed IPs that are free")
+	flag.BoolVar(&failOnDrift, "fail-on-drift", false, fmt.Sprintf("with -expected, exit with code %d when the used IPs differ from the list", exitDrift))
+	flag.StringVar(&notesFile, "notes-file", defaultNotesPath(), "keep the notes on IPs in this file; n in the TUI edits the note of the selected IP (empty disables notes)")
+	flag.StringVar(&leaseFile, "leases", "", "compare the results with this ISC dhcpd lease file")
+	flag.BoolVar(&mdns, "mdns", false, "ask used IPs on the local link for their name over mDNS when there is no PTR record")
+	flag.BoolVar(&netbios, "netbios", false, "ask used IPv4 hosts for their NetBIOS name when there is no PTR record, for Windows machines")
+	flag.StringVar(&community, "snmp-community", "", "fetch sysName and sysDescr of used IPs over SNMPv2c with this community, e.g. public")
+	flag.BoolVar(&resolve, "resolve", false, "look up the hostnames of used IPs")
+	flag.StringVar(&dnsServer, "resolver", "", "DNS server for -resolve, as an IP with an optional port, instead of the system resolver")
+	flag.DurationVar(&dnsTimeout, "dns-timeout", defaultDNSTimeout, "how long to wait for the name of a single IP with -resolve")
+	flag.BoolVar(&display.group, "group", false, "show the results of every pool in its own section (default when several pools are given)")
+	flag.StringVar(&display.sort, "sort", "ip", "order of the results: ip, status (used first) or rtt (fastest first)")
+	flag.StringVar(&outputDir, "output-dir", "", "also write the results of every scan to a timestamped JSON file in this directory, plus CSV, Markdown or HTML when chosen")
+	flag.StringVar(&display.html, "html", "", "also write the results as an HTML report to this file")
+	flag.StringVar(&logLevel, "log-level", "warn", "log level: debug, info, warn or error")
+	flag.StringVar(&logFile, "log-file", "", "file to write logs to")
+	flag.StringVar(&format, "format", "tui", "output format: tui, json, jsonl (a line of JSON per IP as it is probed, then a summary), csv, markdown, compact (one line per IP; the default for a single bare IP) or grepable (like nmap -oG)")
+	flag.StringVar(&serveAddr, "serve", "", "serve the scan as a live web page on this address, e.g. :8080, instead of the TUI")
+	flag.DurationVar(&watch, "watch", 0, "scan again every this long, e.g. 5m, and print the IPs that changed between used and free")
+	flag.DurationVar(&every, "every", 0, "scan again every this long, e.g. 5m, updating the TUI or writing the results of every scan, and mark the IPs that changed since the scan before")
+	flag.StringVar(&webhookURL, "webhook", "", "with -watch or -every, POST every change between used and free as JSON to this URL")
+	flag.StringVar(&dbPath, "db", "", "also record every scan in this SQLite database, for -history")
+	flag.StringVar(&history, "history", "", "print when this IP was used or free in the scans recorded in -db and exit")
+	flag.StringVar(&textfile, "textfile", "", "write the metrics of every scan to this file in the Prometheus text format, for the node_exporter textfile collector")
+	flag.StringVar(&metricsAddr, "metrics", "", "serve the results of the scan as Prometheus metrics on /metrics at this address, e.g. :9100")
+	flag.BoolVar(&aggregated, "aggregate", false, "print the used IPs as the smallest set of CIDR blocks, one per line")
+	flag.BoolVar(&summaryOnly, "summary", false, "print only the summary line, e.g. \"12 used, 242 free of 254 in 10.0.0.0/24, took 8s\"")
+	flag.BoolVar(&rollup, "rollup", false, "print a line with the totals of every pool; with -format json, csv, markdown or compact before the results")
+	flag.BoolVar(&ndjson, "ndjson", false, "same as -format jsonl")
+	flag.DurationVar(&cacheTTL, "cache-ttl", 0, "skip IPs that answered within this long, e.g. 10m (0 disables the cache)")
+	flag.StringVar(&cacheFile, "cache-file", defaultCachePath(), "keep the cache in this file between runs (empty keeps it in memory)")
+	flag.BoolVar(&noCache, "no-cache", false, "probe every IP, ignoring -cache-ttl")
+	flag.BoolVar(&noColor, "no-color", false, "show the TUI without colors (also when NO_COLOR is set)")
+	flag.StringVar(&themeName, "theme", "default", "TUI theme: default, colorblind (blue and orange with symbols) or mono (symbols without colors)")
+	flag.StringVar(&colors, "colors", "", "override TUI colors, e.g. used=blue,free=magenta (names: used, free, conflict, unknown, warning)")
+	flag.StringVar(&configPath, "config", defaultConfigPath(), "read default flags from this YAML file")
+	flag.BoolVar(&showVersion, "version", false, "print version information and exit")
+	flag.Parse()
+
+	// The version is printed even if the environment or the config file
+	// holds an invalid setting.
+	if showVersion {
+		fmt.Println(versionString())
+		return
+	}
 
-	if len(os.Args) > 1 && os.Args[1] == "-u" {
-		showOnlyUsedIPs = true
+	// Flags win over environment variables, which win over the config file.
+	given := givenFlags()
+	cidrGiven := commandLinePools(given, cidrs)
+	if err := applyEnv(given); err != nil {
+		fatalf("%s", err)
+	}
+	if configPath != "" {
+		if err := applyConfig(configPath, given["config"], given); err != nil {
+			fatalf("%s", err)
+		}
 	}
 
-	app := tview.NewApplication()
-	inputField := tview.NewInputField().
-		SetLabel("Enter address and mask prefix to analyze: ").
-		SetFieldWidth(inputFieldWidth).
-		SetDoneFunc(func(key tcell.Key) {
-			app.Stop()
-		})
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "group" {
+			display.groupSet = true
+		}
+	})
 
-	err := app.SetRoot(inputField, true).SetFocus(inputField).Run()
-	if err != nil {
-		log.Fatal(err)
+	if history != "" {
+		ip := net.ParseIP(history)
+		if ip == nil {
+			fatalf("Invalid IP %q for -history", history)
+		}
+		if dbPath == "" {
+			fatalf("-history needs -db")
+		}
+		db, err := openScanDB(dbPath)
+		if err != nil {
+			fatalf("%s", err)
+		}
+		defer db.Close()
+		observations, err := db.History(ip)
+		if err != nil {
+			fatalf("Unable to read history of %s: %s", ip, err)
+		}
+		writeHistory(os.Stdout, ip, observations)
+		return
 	}
 
-	analyzer := NewAnalizer()
-
-	textView := tview.NewTextView().
-		SetDynamicColors(true).
-		SetRegions(true).
-		SetChangedFunc(func() {
-			app.Draw()
-		})
+	theme, ok := themes[themeName]
+	if !ok {
+		fatalf("Unknown theme %q: must be default, colorblind or mono", themeName)
+	}
+	display.theme = theme
+	if path := defaultHistoryPath(); path != "" {
+		display.history = fileHistory{path: path}
+	} else {
+		display.history = &memoryHistory{}
+	}
+	// The fallback is logged once the logger is set up.
+	colorless := false
+	if noColor || os.Getenv("NO_COLOR") != "" {
+		display.theme = noColorTheme
+		display.theme.Symbols = theme.Symbols
+	} else if colors != "" {
+		var err error
+		if display.theme, err = parseTheme(colors, theme); err != nil {
+			fatalf("%s", err)
+		}
+	} else if !terminalHasColor() {
+		display.theme = markerTheme
+		colorless = true
+	}
 
-	go func() {
-		pool := make(map[*net.IP]bool)
-
-		go func() {
-			count := 0
-			msg := "loading"
-			for len(pool) == 0 {
-				textView.Clear()
-				fmt.Fprintf(textView, "%s", msg)
-				time.Sleep(500 * time.Millisecond)
-				msg += "."
-				count++
-				if count == 4 {
-					msg = "loading"
-					count = 0
-				}
-			}
-		}()
+	if pingSize < minPingSize || pingSize > maxPingSize {
+		fatalf("Invalid ping size %d: must be between %d and %d bytes", pingSize, minPingSize, maxPingSize)
+	}
 
-		pool, err = analyzer.analyze(inputField.GetText())
+	if cacheTTL < 0 {
+		fatalf("Invalid cache TTL %s: must not be negative", cacheTTL)
+	}
+	if timeout <= 0 {
+		fatalf("Invalid timeout %s: must be positive", timeout)
+	}
+	if hostTimeout < 0 {
+		fatalf("Invalid host timeout %s: must not be negative", hostTimeout)
+	}
+	if deadline < 0 {
+		fatalf("Invalid deadline %s: must not be negative", deadline)
+	}
+	if warmup < 0 {
+		fatalf("Invalid warm-up %s: must not be negative", warmup)
+	}
+	if udpPort < 0 || udpPort > 65535 {
+		fatalf("Invalid UDP port %d", udpPort)
+	}
+	if dryRunUsed < 0 || dryRunUsed > 1 {
+		fatalf("Invalid share of used IPs %g: must be between 0 and 1", dryRunUsed)
+	}
+	if count < 1 {
+		fatalf("Invalid count %d: must be at least 1", count)
+	}
+	if interval < 0 {
+		fatalf("Invalid interval %s: must not be negative", interval)
+	}
+	if workers < 1 {
+		fatalf("Invalid number of workers %d: must be at least 1", workers)
+	}
+	if icmpMode != icmpAuto && icmpMode != icmpRaw && icmpMode != icmpUnprivileged {
+		fatalf("Invalid ICMP mode %q: must be auto, raw or unprivileged", icmpMode)
+	}
+	if tcpPorts != "" && udpPort != 0 {
+		fatalf("-tcp and -udp cannot be combined")
+	}
+	if withICMP && tcpPorts == "" && udpPort == 0 {
+		fatalf("-with-icmp needs -tcp or -udp")
+	}
+	if banner && tcpPorts == "" {
+		fatalf("-banner needs -tcp")
+	}
+	if maxLoss <= 0 || maxLoss > 100 {
+		fatalf("Invalid packet loss %g%%: must be above 0 and at most 100", maxLoss)
+	}
+	if requireAll && tcpPorts == "" {
+		fatalf("-require-all needs -tcp")
+	}
+	if requireAll && withICMP {
+		fatalf("-require-all and -with-icmp cannot be combined")
+	}
+	if !lo.Contains(sortOrders, display.sort) {
+		fatalf("Invalid sort order %q: must be ip, status or rtt", display.sort)
+	}
+	if watch < 0 {
+		fatalf("Invalid watch interval %s: must be positive", watch)
+	}
+	if every < 0 {
+		fatalf("Invalid scan interval %s: must be positive", every)
+	}
+	if every > 0 && watch > 0 {
+		fatalf("-every and -watch cannot be combined")
+	}
+	if every > 0 && serveAddr != "" {
+		fatalf("-every and -serve cannot be combined")
+	}
+	if dnsServer != "" {
+		if !resolve {
+			fatalf("-resolver needs -resolve")
+		}
+		server, err := parseDNSServer(dnsServer)
 		if err != nil {
-			log.Fatal(err)
+			fatalf("%s", err)
 		}
+		dnsServer = server
+	}
+	if dnsTimeout <= 0 {
+		fatalf("Invalid DNS timeout %s: must be positive", dnsTimeout)
+	}
+	if shuffleSeed != 0 && !shuffle {
+		fatalf("-shuffle-seed needs -shuffle")
+	}
+	if webhookURL != "" && watch == 0 && every == 0 {
+		fatalf("-webhook needs -watch or -every")
+	}
 
-		textView.Clear()
+	closeLog, err := setupLogger(logLevel, logFile)
+	if err != nil {
+		fatalf("%s", err)
+	}
+	if colorless {
+		logger.Info("terminal has no colors, marking the status instead", "term", os.Getenv("TERM"))
+	}
 
-		var ips []*net.IP
-		for ip := range pool {
-			if showOnlyUsedIPs && !pool[ip] {
-				continue
+	switch {
+	case serveAddr != "":
+		format = "serve"
+	case watch > 0:
+		format = "watch"
+	case ndjson:
+		format = "jsonl"
+	case aggregated:
+		format = "aggregate"
+	case summaryOnly:
+		format = "summary"
+	case rollup && format == "tui":
+		format = "rollup"
+	}
+	display.rollup = rollup
+	display.every = every
+
+	// With several interfaces, traces go out of the first one.
+	ifaces := parseInterfaces(iface)
+	opts := Options{
+		Size:              pingSize,
+		Timeout:           timeout,
+		HostTimeout:       hostTimeout,
+		Deadline:          deadline,
+		Warmup:            warmup,
+		Interface:         lo.FirstOrEmpty(ifaces),
+		Interfaces:        ifaces,
+		ARP:               arp,
+		ND:                nd,
+		Resolve:           resolve,
+		DNSServer:         dnsServer,
+		DNSTimeout:        dnsTimeout,
+		MDNS:              mdns,
+		NetBIOS:           netbios,
+		SNMPCommunity:     community,
+		ICMPMode:          icmpMode,
+		UDPPort:           udpPort,
+		Banner:            banner,
+		WithICMP:          withICMP,
+		RequireAll:        requireAll,
+		MaxLoss:           lo.Ternary(maxLoss < 100, maxLoss/100, 0),
+		UnreachableAsFree: unreachable,
+		Enum:              enum,
+		Exclude:           excludes,
+		Workers:           workers,
+		Count:             count,
+		Interval:          interval,
+		Adaptive:          adaptive,
+		Priority:          priority,
+		Shuffle:           shuffle,
+		ShuffleSeed:       shuffleSeed,
+		FailFast:          failFast,
+		AutoWorkers:       autoWorkers,
+	}
+	if tcpPorts != "" {
+		if opts.TCPPorts, err = parsePorts(tcpPorts); err != nil {
+			fatalf("%s", err)
+		}
+	}
+	if cacheTTL > 0 && !noCache && !dryRun {
+		opts.Cache = newResultCache(cacheTTL, cacheFile)
+	}
+	if dryRun {
+		opts.Pinger = newDryRunPinger(opts, dryRunUsed)
+	}
+	if compareFile != "" {
+		if opts.Compare, err = readComparison(compareFile); err != nil {
+			fatalf("%s", err)
+		}
+	}
+	if expected != "" {
+		if display.expected, err = readExpected(expected); err != nil {
+			fatalf("%s", err)
+		}
+		if display.expected == nil {
+			display.expected = []net.IP{}
+		}
+	} else if failOnDrift {
+		fatalf("-fail-on-drift needs -expected")
+	}
+	if notesFile != "" {
+		if opts.Notes, err = loadNotes(notesFile); err != nil {
+			fatalf("%s", err)
+		}
+	}
+	if leaseFile != "" {
+		if opts.Leases, err = readLeaseFile(leaseFile); err != nil {
+			fatalf("%s", err)
+		}
+	}
+	var board *dashboard
+	switch format {
+	case "jsonl":
+		opts.OnResult = newJSONLWriter(os.Stdout, display)
+	case "serve":
+		board = newDashboard(display)
+		opts.OnResult = board.add
+	}
+	var onScanDone []func([]Result, ScanMeta)
+	if metricsAddr != "" || textfile != "" {
+		collector := &metricsCollector{}
+		onScanDone = append(onScanDone, collector.Update)
+		if metricsAddr != "" {
+			stopMetrics, err := serveMetrics(metricsAddr, collector)
+			if err != nil {
+				fatalf("%s", err)
 			}
-			ips = append(ips, ip)
+			defer stopMetrics()
 		}
-
-		sort.Slice(ips, func(i, j int) bool {
-			return bytes.Compare(*ips[i], *ips[j]) < 0
+		if textfile != "" {
+			onScanDone = append(onScanDone, func([]Result, ScanMeta) {
+				if err := writeTextfile(textfile, collector); err != nil {
+					logger.Error("writing metrics failed", "file", textfile, "err", err)
+					if format != "tui" {
+						fmt.Fprintln(os.Stderr, err)
+					}
+				}
+			})
+		}
+	}
+	if outputDir != "" {
+		onScanDone = append(onScanDone, func(results []Result, meta ScanMeta) {
+			files, err := writeRunFiles(outputDir, meta, results, format, display)
+			if err != nil {
+				logger.Error("writing output files failed", "dir", outputDir, "err", err)
+				if format != "tui" {
+					fmt.Fprintln(os.Stderr, err)
+				}
+				return
+			}
+			logger.Info("wrote output files", "files", files)
 		})
+	}
+	if dbPath != "" {
+		db, err := openScanDB(dbPath)
+		if err != nil {
+			fatalf("%s", err)
+		}
+		defer db.Close()
+		onScanDone = append(onScanDone, func(results []Result, meta ScanMeta) {
+			if err := db.Record(meta, results); err != nil {
+				logger.Error("recording scan failed", "db", dbPath, "err", err)
+				if format != "tui" {
+					fmt.Fprintf(os.Stderr, "Unable to record scan in %s: %s\n", dbPath, err)
+				}
+			}
+		})
+	}
+	if len(onScanDone) > 0 {
+		opts.OnScanDone = func(results []Result, meta ScanMeta) {
+			for _, done := range onScanDone {
+				done(results, meta)
+			}
+		}
+	}
+	analyzer := NewAnalizer(opts)
 
-		fmt.Fprintf(textView, "Analyzed address pool: %s\n\n", inputField.GetText())
-
-		for i := 0; i < len(ips); i += numColumns {
-			for j := 0; j < numColumns; j++ {
-				if i+j < len(ips) {
-					ip := ips[i+j]
+	targets := poolTargets(flag.Args(), cidrs, cidrGiven)
+	if len(targets) == 0 && !isTerminal(os.Stdin) {
+		targets, err = readTargets(os.Stdin)
+		if err != nil {
+			fatalf("Unable to read targets from stdin: %s", err)
+		}
+	}
 
-					status := lo.If(pool[ip], "used").Else("free")
-					color := lo.If(pool[ip], "[green]").Else("[red]")
+	// A quick check of a single host needs no TUI.
+	if format == "tui" && !given["format"] && len(targets) == 1 && net.ParseIP(targets[0]) != nil {
+		format = "compact"
+	}
 
-					fmt.Fprintf(textView, "%-*s - %s%-4s[white]    ", paddingBetweenIpState, ip, color, status)
-				} else {
-					fmt.Fprintf(textView, "%-*s    ", columntPadding, "")
-				}
+	if local {
+		subnets, err := localSubnets()
+		if err != nil {
+			fatalf("%s", err)
+		}
+		switch {
+		case len(subnets) == 0:
+			fatalf("No local IPv4 subnet found")
+		case len(subnets) == 1:
+			targets = append(targets, subnets[0].CIDR)
+		case format == "tui":
+			cidr, err := chooseLocalSubnet(subnets)
+			if err != nil {
+				fatalf("%s", err)
+			}
+			if cidr == "" {
+				return
+			}
+			targets = append(targets, cidr)
+		default:
+			var names []string
+			for _, subnet := range subnets {
+				names = append(names, fmt.Sprintf("%s (%s)", subnet.CIDR, subnet.Interface))
 			}
-			fmt.Fprintln(textView)
+			fatalf("Several local subnets found, pass one of them instead of -local: %s", strings.Join(names, ", "))
 		}
-	}()
+	}
+
+	var (
+		hook     *webhook
+		onChange func(statusChange)
+	)
+	if webhookURL != "" {
+		hook = newWebhook(webhookURL)
+		onChange = hook.Notify
+	}
 
-	textView.SetBorder(true).SetTitle("IP address analyzer")
-	err = app.SetRoot(textView, true).SetFocus(textView).Run()
+	var results []Result
+	switch format {
+	case "tui":
+		results, err = runTUI(analyzer, targets, display, onChange)
+	case "json", "jsonl", "csv", "markdown", "compact", "grepable", "aggregate", "summary", "rollup":
+		if len(targets) == 0 {
+			fatalf("Address and mask prefix to analyze must be given as an argument")
+		}
+		if every > 0 {
+			results, err = runEvery(os.Stdout, analyzer, targets, format, every, display, onChange)
+		} else {
+			results, err = runHeadless(os.Stdout, analyzer, targets, format, display, nil)
+		}
+	case "serve":
+		if len(targets) == 0 {
+			fatalf("Address and mask prefix to analyze must be given as an argument")
+		}
+		results, err = runServe(serveAddr, analyzer, targets, board)
+	case "watch":
+		if len(targets) == 0 {
+			fatalf("Address and mask prefix to analyze must be given as an argument")
+		}
+		results, err = runWatch(os.Stdout, analyzer, targets, watch, display, onChange)
+	default:
+		fatalf("Unknown output format: %s", format)
+	}
+	if hook != nil {
+		hook.Close()
+	}
 	if err != nil {
-		log.Fatal(err)
+		fatalf("%s", err)
 	}
+	if metricsAddr != "" && format != "tui" && format != "serve" && format != "watch" {
+		waitForInterrupt(fmt.Sprintf("Serving metrics on %s/metrics. Press Ctrl-C to stop.", metricsAddr))
+	}
+
+	// os.Exit skips deferred calls, so the log is closed here.
+	code := exitCode(results, analyzer.Stopped(), failOnDrift && display.drift(results))
+	closeLog()
+	os.Exit(code)
 }
 
-type Analyzer struct {
-	mu sync.RWMutex
-	wg sync.WaitGroup
+// exitCode returns the exit code of a scan with results, see the exit
+// constants.
+func exitCode(results []Result, interrupted, drift bool) int {
+	summary := Summarize(results)
+	switch {
+	case interrupted:
+		return exitInterrupted
+	case drift:
+		return exitDrift
+	case summary.Used > 0:
+		return exitUsed
+	case summary.Unknown > 0:
+		return exitUnknown
+	default:
+		return exitAllFree
+	}
 }
 
-func NewAnalizer() *Analyzer {
-	return &Analyzer{}
+func fatalf(format string, v ...any) {
+	log.Printf(format, v...)
+	os.Exit(exitSetupError)
 }
 
-func (a *Analyzer) analyze(adessWithPrefix string) (map[*net.IP]bool, error) {
-	_, network, err := net.ParseCIDR(adessWithPrefix)
-	if err != nil {
-		return nil, fmt.Errorf("Invalid address: %s", adessWithPrefix)
+// stringList is a flag that can be given several times. Every value may hold
+// several comma or space separated items.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, parseTargets(value)...)
+	return nil
+}
+
+// poolTargets returns the pools to analyze: the arguments together with the
+// pools of -cidr, or, without arguments, the pools of -cidr as set on the
+// command line, by IPDEFINER_CIDR or by the config file, in this order of
+// precedence. If there are none the pools are read from stdin or asked for.
+func poolTargets(args, cidrs []string, cidrGiven bool) []string {
+	if len(args) > 0 && !cidrGiven {
+		return args
 	}
+	return append(slices.Clip(args), cidrs...)
+}
 
-	numberOfAddessOnes, numberOfAddressBits := network.Mask.Size()
-	maximumNumberOfHostst := 1<<(numberOfAddressBits-numberOfAddessOnes) - 2
+// commandLinePools reports whether -cidr gave pools on the command line. An
+// empty -cidr, as a unit file may pass, is dropped from given, so that
+// IPDEFINER_CIDR and the config file still apply.
+func commandLinePools(given map[string]bool, cidrs []string) bool {
+	if len(cidrs) == 0 {
+		delete(given, "cidr")
+	}
+	return given["cidr"]
+}
 
-	addressPool := make(map[*net.IP]bool)
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
 
-	for i := 1; i < maximumNumberOfHostst+1; i++ {
-		increment(&network.IP, int(math.Round(float64(numberOfAddessOnes/8))), 1)
-		currentIP := make(net.IP, len(network.IP))
-		copy(currentIP, network.IP)
+type displayOptions struct {
+	onlyUsed bool
+	hist     bool
+	html     string
 
-		a.wg.Add(1)
-		go func(ip net.IP) {
-			defer a.wg.Done()
-			used, err := pingAddress(ip)
-			if err != nil {
-				return
-			}
+	// theme colors the TUI.
+	theme Theme
+
+	// quiet leaves out everything but the data rows in headless mode.
+	quiet bool
+
+	// group is only honored when groupSet, otherwise results are grouped
+	// whenever more than one pool is scanned.
+	group    bool
+	groupSet bool
 
-			a.mu.Lock()
-			addressPool[&ip] = used
-			a.mu.Unlock()
-		}(currentIP)
+	// expected are the IPs that should be used, nil unless given.
+	expected []net.IP
+
+	// sort is one of sortOrders.
+	sort string
+
+	// rollup adds the totals of every pool to the headless output.
+	rollup bool
+
+	// every scans again this often in the TUI, 0 for a single scan.
+	every time.Duration
+
+	// history keeps the pools entered in the TUI, nil for none.
+	history targetHistory
+}
+
+func (d displayOptions) grouped(targets []string) bool {
+	if d.groupSet {
+		return d.group
 	}
-	a.wg.Wait()
+	return len(targets) > 1
+}
 
-	return addressPool, nil
+// groupByBlock returns the results that belong to each block.
+// An address in overlapping blocks is part of every one of them.
+func groupByBlock(results []Result) map[string][]Result {
+	groups := make(map[string][]Result)
+	for _, result := range results {
+		for _, block := range result.Blocks {
+			groups[block] = append(groups[block], result)
+		}
+	}
+	return groups
 }
 
-func pingAddress(address net.IP) (bool, error) {
-	pinger := ping.New(address.String())
+func summaryLine(summary Summary) string {
+	if summary.Unknown > 0 {
+		return fmt.Sprintf("%d used, %d free, %d unknown of %d", summary.Used, summary.Free, summary.Unknown, summary.Total)
+	}
+	return fmt.Sprintf("%d used, %d free of %d", summary.Used, summary.Free, summary.Total)
+}
 
-	pinger.Count = 2
-	pinger.Timeout = 5 * time.Second
+// deadlineNote returns a note on why the scan ended early, if it did: its
+// deadline passed or it was interrupted. The addresses left out are counted
+// as unknown in the summary.
+func deadlineNote(meta ScanMeta) string {
+	switch {
+	case meta.Interrupted:
+		return " (interrupted)"
+	case meta.NotScanned > 0:
+		return " (deadline passed)"
+	default:
+		return ""
+	}
+}
 
-	err := pinger.Run()
-	if err != nil {
-		return false, err
+// trafficNote describes what the scan sent, e.g. ", sent ~254 KB", if it
+// sent anything.
+func trafficNote(meta ScanMeta) string {
+	return lo.Ternary(meta.PacketsSent > 0, ", sent ~"+formatBytes(meta.BytesSent), "")
+}
+
+// formatBytes formats n in decimal units, e.g. 254 KB for 254000.
+func formatBytes(n int64) string {
+	const unit = 1000
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit && exp < 3; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.0f %cB", float64(n)/float64(div), "KMGT"[exp])
+}
+
+func truncate(s string, width int) string {
+	if utf8.RuneCountInString(s) <= width {
+		return s
 	}
+	return string([]rune(s)[:width-1]) + "…"
+}
 
-	if pinger.PacketsRecv > 0 {
-		return true, nil
+func statusText(result Result) string {
+	if result.Conflict() {
+		return "conflict"
 	}
+	return result.Status().String()
+}
 
-	return false, nil
+func splitFamilies(results []Result) (v4, v6 []Result) {
+	for _, result := range results {
+		if result.IP.To4() != nil {
+			v4 = append(v4, result)
+		} else {
+			v6 = append(v6, result)
+		}
+	}
+	return v4, v6
 }
 
-func increment(address *net.IP, lastOctet, numberToIcrementBy int) {
-	if lastOctet == 3 && (*address)[lastOctet] == 255 {
-		return
+func visibleResults(results []Result, display displayOptions) []Result {
+	var shown []Result
+	for _, result := range results {
+		if display.onlyUsed && !result.Used {
+			continue
+		}
+		shown = append(shown, result)
 	}
-	for (*address)[lastOctet] == 254 {
-		lastOctet++
+
+	sortResults(shown, display.sort)
+
+	return shown
+}
+
+// Orders for sortResults.
+var sortOrders = []string{"ip", "status", "rtt"}
+
+// sortResults sorts results in place: by IP, by status with conflicts and
+// used IPs first, or by round-trip time with free IPs last. Ties and an
+// empty order are sorted by IP.
+func sortResults(results []Result, by string) {
+	rank := func(r Result) int {
+		return lo.If(r.Conflict(), 0).ElseIf(r.Used, 1).ElseIf(r.Status() == StatusFree, 2).Else(3)
 	}
-	(*address)[lastOctet] += byte(numberToIcrementBy)
+	sort.SliceStable(results, func(i, j int) bool {
+		a, b := results[i], results[j]
+		switch by {
+		case "status":
+			if rank(a) != rank(b) {
+				return rank(a) < rank(b)
+			}
+		case "rtt":
+			if a.Used != b.Used {
+				return a.Used
+			}
+			if a.RTT != b.RTT {
+				return a.RTT < b.RTT
+			}
+		}
+		return compareIPs(a.IP, b.IP) < 0
+	})
 }
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestPoolTargets(t *testing.T) {
+	tests := []struct {
+		name   string
+		args   []string
+		env    string
+		config string
+		want   []string
+		hosts  int
+	}{
+		{
+			name:   "flag over environment and config file",
+			args:   []string{"-cidr", "10.0.1.0/30"},
+			env:    "10.0.2.0/30",
+			config: "cidr: 10.0.3.0/30\n",
+			want:   []string{"10.0.1.0/30"},
+			hosts:  2,
+		},
+		{
+			name:   "environment over config file",
+			env:    "10.0.2.0/30",
+			config: "cidr: 10.0.3.0/30\n",
+			want:   []string{"10.0.2.0/30"},
+			hosts:  2,
+		},
+		{
+			name:   "config file",
+			config: "cidr: [10.0.3.0/30, 10.0.4.0/30]\n",
+			want:   []string{"10.0.3.0/30", "10.0.4.0/30"},
+			hosts:  4,
+		},
+		{
+			name:   "empty flag falls through",
+			args:   []string{"-cidr", ""},
+			env:    "10.0.2.0/30",
+			config: "cidr: 10.0.3.0/30\n",
+			want:   []string{"10.0.2.0/30"},
+			hosts:  2,
+		},
+		{
+			name:   "empty flag falls through to the config file",
+			args:   []string{"-cidr="},
+			config: "cidr: 10.0.3.0/30\n",
+			want:   []string{"10.0.3.0/30"},
+			hosts:  2,
+		},
+		{
+			name:   "arguments over environment and config file",
+			args:   []string{"10.0.5.0/30"},
+			env:    "10.0.2.0/30",
+			config: "cidr: 10.0.3.0/30\n",
+			want:   []string{"10.0.5.0/30"},
+			hosts:  2,
+		},
+		{
+			name:  "flag adds to the arguments",
+			args:  []string{"-cidr", "10.0.1.0/30", "10.0.5.0/30"},
+			env:   "10.0.2.0/30",
+			want:  []string{"10.0.5.0/30", "10.0.1.0/30"},
+			hosts: 4,
+		},
+		{
+			name:  "overlapping pools",
+			args:  []string{"-cidr", "10.0.0.0/29,10.0.0.4/30", "10.0.0.0/28", "10.0.0.1"},
+			want:  []string{"10.0.0.0/28", "10.0.0.1", "10.0.0.0/29", "10.0.0.4/30"},
+			hosts: 14,
+		},
+		{
+			name: "none",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var cidrs stringList
+			defer func(commandLine *flag.FlagSet) { flag.CommandLine = commandLine }(flag.CommandLine)
+			flag.CommandLine = flag.NewFlagSet("ipdefiner", flag.ContinueOnError)
+			flag.Var(&cidrs, "cidr", "")
+			if err := flag.CommandLine.Parse(tt.args); err != nil {
+				t.Fatal(err)
+			}
+			if tt.env != "" {
+				t.Setenv("IPDEFINER_CIDR", tt.env)
+			}
+			path := filepath.Join(t.TempDir(), "config.yaml")
+			if err := os.WriteFile(path, []byte(tt.config), 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			given := givenFlags()
+			cidrGiven := commandLinePools(given, cidrs)
+			if err := applyEnv(given); err != nil {
+				t.Fatalf("applyEnv: %v", err)
+			}
+			if err := applyConfig(path, true, given); err != nil {
+				t.Fatalf("applyConfig: %v", err)
+			}
+			targets := poolTargets(flag.Args(), cidrs, cidrGiven)
+			if !slices.Equal(targets, tt.want) {
+				t.Fatalf("poolTargets = %v, want %v", targets, tt.want)
+			}
+
+			set, err := enumerate(targets, EnumOptions{})
+			if err != nil {
+				t.Fatalf("enumerate(%v): %v", targets, err)
+			}
+			if hosts, _ := set.Count(); hosts != tt.hosts {
+				t.Errorf("%d hosts in %v, want %d", hosts, targets, tt.hosts)
+			}
+		})
+	}
+}
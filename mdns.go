@@ -0,0 +1,108 @@
+package main
+
+import (
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+const (
+	mdnsPort    = 5353
+	mdnsTimeout = time.Second
+)
+
+// lookupMDNS asks the host itself for its name with a reverse mDNS query sent
+// to its mDNS port. Responders such as Avahi and Bonjour answer such legacy
+// unicast queries directly, which names devices that have no PTR record in
+// DNS. It returns an empty string if the host does not answer in time.
+func lookupMDNS(ip net.IP) string {
+	name, err := reverseName(ip)
+	if err != nil {
+		return ""
+	}
+
+	id := uint16(time.Now().UnixNano())
+	query := dnsmessage.Message{
+		Header: dnsmessage.Header{ID: id},
+		Questions: []dnsmessage.Question{{
+			Name:  name,
+			Type:  dnsmessage.TypePTR,
+			Class: dnsmessage.ClassINET,
+		}},
+	}
+	packet, err := query.Pack()
+	if err != nil {
+		return ""
+	}
+
+	conn, err := net.DialUDP("udp", nil, &net.UDPAddr{IP: ip, Port: mdnsPort})
+	if err != nil {
+		logger.Debug("mdns lookup failed", "ip", ip, "err", err)
+		return ""
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(mdnsTimeout))
+	if _, err := conn.Write(packet); err != nil {
+		logger.Debug("mdns lookup failed", "ip", ip, "err", err)
+		return ""
+	}
+
+	buf := make([]byte, 9000)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			logger.Debug("mdns lookup failed", "ip", ip, "err", err)
+			return ""
+		}
+		if hostname := ptrAnswer(buf[:n], id, name); hostname != "" {
+			return hostname
+		}
+	}
+}
+
+// ptrAnswer returns the target of the PTR record for name in the reply, if
+// the reply answers the query with the given ID.
+func ptrAnswer(reply []byte, id uint16, name dnsmessage.Name) string {
+	var parser dnsmessage.Parser
+	header, err := parser.Start(reply)
+	if err != nil || !header.Response || (header.ID != id && header.ID != 0) {
+		return ""
+	}
+	if err := parser.SkipAllQuestions(); err != nil {
+		return ""
+	}
+	for {
+		answer, err := parser.AnswerHeader()
+		if err != nil {
+			return ""
+		}
+		if answer.Type != dnsmessage.TypePTR || !strings.EqualFold(answer.Name.String(), name.String()) {
+			parser.SkipAnswer()
+			continue
+		}
+		ptr, err := parser.PTRResource()
+		if err != nil {
+			return ""
+		}
+		return strings.TrimSuffix(ptr.PTR.String(), ".")
+	}
+}
+
+// reverseName returns the in-addr.arpa or ip6.arpa name of ip.
+func reverseName(ip net.IP) (dnsmessage.Name, error) {
+	var labels []string
+	if v4 := ip.To4(); v4 != nil {
+		for i := len(v4) - 1; i >= 0; i-- {
+			labels = append(labels, strconv.Itoa(int(v4[i])))
+		}
+		return dnsmessage.NewName(strings.Join(labels, ".") + ".in-addr.arpa.")
+	}
+	const hex = "0123456789abcdef"
+	for i := len(ip) - 1; i >= 0; i-- {
+		labels = append(labels, string(hex[ip[i]&0x0f]), string(hex[ip[i]>>4]))
+	}
+	return dnsmessage.NewName(strings.Join(labels, ".") + ".ip6.arpa.")
+}
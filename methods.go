@@ -0,0 +1,157 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"net"
+	"sync"
+
+	"github.com/go-ping/ping"
+	"github.com/samber/lo"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+// Probe methods recorded in Result.Methods.
+const (
+	methodICMP = "icmp"
+	methodUDP  = "udp"
+	methodTCP  = "tcp"
+	methodND   = "nd"
+)
+
+// hostDetailer is implemented by pingers that learn more about a host than
+// its statistics carry. addDetails fills that into result and forgets it.
+type hostDetailer interface {
+	addDetails(result *Result)
+}
+
+// byteCounter is implemented by the pingers of the scanner. bytesSent
+// estimates the size on the wire, headers included, of the probes of ip that
+// stats counts. Pingers that merge the statistics of several probes remember
+// their traffic instead and forget it then.
+type byteCounter interface {
+	bytesSent(ip net.IP, stats *ping.Statistics) int
+}
+
+// countBytes returns what pinger reports as the traffic of stats, or 0 when
+// it does not know.
+func countBytes(pinger Pinger, ip net.IP, stats *ping.Statistics) int {
+	counter, ok := pinger.(byteCounter)
+	if !ok || stats == nil {
+		return 0
+	}
+	return counter.bytesSent(ip, stats)
+}
+
+// ipHeaderLen is the size of the IP header of a probe of ip, without options.
+func ipHeaderLen(ip net.IP) int {
+	return lo.Ternary(ip.To4() != nil, ipv4.HeaderLen, ipv6.HeaderLen)
+}
+
+// namedPinger is one of the probes of a multiPinger.
+type namedPinger struct {
+	method string
+	pinger Pinger
+}
+
+// multiPinger runs several probes of a host at the same time and merges their
+// statistics. It remembers which probes the host answered and what they sent.
+type multiPinger struct {
+	probes []namedPinger
+
+	mu       sync.Mutex
+	answered map[string][]string
+	sent     map[string]int
+}
+
+func newMultiPinger(probes []namedPinger) *multiPinger {
+	return &multiPinger{probes: probes, answered: make(map[string][]string), sent: make(map[string]int)}
+}
+
+func (p *multiPinger) Ping(ctx context.Context, address net.IP, onRecv func(*ping.Packet)) (*ping.Statistics, error) {
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		stats   = make([]*ping.Statistics, len(p.probes))
+		errs    = make([]error, len(p.probes))
+		methods []string
+	)
+	// The callers' onRecv does not expect concurrent calls.
+	recv := func(packet *ping.Packet) {
+		mu.Lock()
+		defer mu.Unlock()
+		if onRecv != nil {
+			onRecv(packet)
+		}
+	}
+	for i, probe := range p.probes {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			stats[i], errs[i] = probe.pinger.Ping(ctx, address, recv)
+		}()
+	}
+	wg.Wait()
+
+	merged := &ping.Statistics{IPAddr: &net.IPAddr{IP: address}, Addr: address.String()}
+	var (
+		firstErr error
+		sent     int
+	)
+	for i, probe := range p.probes {
+		sent += countBytes(probe.pinger, address, stats[i])
+		if errs[i] != nil {
+			if isSetupError(errs[i]) {
+				return nil, errs[i]
+			}
+			logger.Debug("probe failed", "ip", address, "method", probe.method, "err", errs[i])
+			firstErr = cmp.Or(firstErr, errs[i])
+			continue
+		}
+		if stats[i] == nil {
+			continue
+		}
+		merged.PacketsSent += stats[i].PacketsSent
+		merged.PacketsRecv += stats[i].PacketsRecv
+		merged.Rtts = append(merged.Rtts, stats[i].Rtts...)
+		if stats[i].PacketsRecv > 0 {
+			methods = append(methods, probe.method)
+		}
+	}
+	if merged.PacketsSent == 0 && firstErr != nil {
+		return nil, firstErr
+	}
+	summarizeStats(merged)
+
+	p.mu.Lock()
+	if len(methods) > 0 {
+		p.answered[address.String()] = methods
+	}
+	p.sent[address.String()] = sent
+	p.mu.Unlock()
+	return merged, nil
+}
+
+// bytesSent adds up the traffic of the probes of the last Ping of ip, whose
+// sizes differ.
+func (p *multiPinger) bytesSent(ip net.IP, _ *ping.Statistics) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	sent := p.sent[ip.String()]
+	delete(p.sent, ip.String())
+	return sent
+}
+
+func (p *multiPinger) addDetails(result *Result) {
+	p.mu.Lock()
+	result.Methods = p.answered[result.IP.String()]
+	delete(p.answered, result.IP.String())
+	p.mu.Unlock()
+
+	for _, probe := range p.probes {
+		if detailer, ok := probe.pinger.(hostDetailer); ok {
+			detailer.addDetails(result)
+		}
+	}
+}
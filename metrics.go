@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	usedDesc     = prometheus.NewDesc("ipdefiner_hosts_used", "Number of addresses that answered in the last scan.", nil, nil)
+	freeDesc     = prometheus.NewDesc("ipdefiner_hosts_free", "Number of addresses that did not answer in the last scan.", nil, nil)
+	unknownDesc  = prometheus.NewDesc("ipdefiner_hosts_unknown", "Number of addresses whose probe failed or did not run in the last scan.", nil, nil)
+	conflictDesc = prometheus.NewDesc("ipdefiner_hosts_conflict", "Number of addresses that answered from more than one MAC address in the last scan.", nil, nil)
+	rttDesc      = prometheus.NewDesc("ipdefiner_rtt_seconds", "Average round-trip time of a used address in the last scan.", []string{"ip"}, nil)
+	durationDesc = prometheus.NewDesc("ipdefiner_scan_duration_seconds", "Duration of the last scan.", nil, nil)
+	finishedDesc = prometheus.NewDesc("ipdefiner_scan_timestamp_seconds", "Time the last scan finished, as a Unix timestamp.", nil, nil)
+)
+
+// metricsCollector exports the results of the latest scan. Nothing is
+// exported before the first scan finishes.
+type metricsCollector struct {
+	mu      sync.Mutex
+	results []Result
+	meta    ScanMeta
+	scanned bool
+}
+
+// Update is the Options.OnScanDone callback that replaces the exported results.
+func (c *metricsCollector) Update(results []Result, meta ScanMeta) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.results, c.meta, c.scanned = results, meta, true
+}
+
+func (c *metricsCollector) Describe(ch chan<- *prometheus.Desc) {
+	prometheus.DescribeByCollect(c, ch)
+}
+
+func (c *metricsCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.scanned {
+		return
+	}
+
+	summary := Summarize(c.results)
+	ch <- prometheus.MustNewConstMetric(usedDesc, prometheus.GaugeValue, float64(summary.Used))
+	ch <- prometheus.MustNewConstMetric(freeDesc, prometheus.GaugeValue, float64(summary.Free))
+	ch <- prometheus.MustNewConstMetric(unknownDesc, prometheus.GaugeValue, float64(summary.Unknown))
+	ch <- prometheus.MustNewConstMetric(conflictDesc, prometheus.GaugeValue, float64(summary.Conflicts))
+	ch <- prometheus.MustNewConstMetric(durationDesc, prometheus.GaugeValue, c.meta.Duration.Seconds())
+	ch <- prometheus.MustNewConstMetric(finishedDesc, prometheus.GaugeValue, float64(c.meta.Finished.UnixMilli())/1000)
+	for _, result := range c.results {
+		if result.Used {
+			ch <- prometheus.MustNewConstMetric(rttDesc, prometheus.GaugeValue, result.RTT.Seconds(), result.IP.String())
+		}
+	}
+}
+
+// writeTextfile writes the metrics of collector to path in the text format,
+// for the textfile collector of node_exporter. The file is replaced
+// atomically, so the collector never reads a partial one.
+func writeTextfile(path string, collector *metricsCollector) error {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(collector)
+	if err := prometheus.WriteToTextfile(path, registry); err != nil {
+		return fmt.Errorf("Unable to write metrics to %s: %w", path, err)
+	}
+	return nil
+}
+
+// serveMetrics serves the metrics of collector on /metrics at addr in the
+// background. The returned function stops the server.
+func serveMetrics(addr string, collector *metricsCollector) (func(), error) {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(collector)
+
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to listen on %s: %w", addr, err)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+	server := &http.Server{Handler: mux}
+	go func() {
+		if err := server.Serve(ln); err != nil && err != http.ErrServerClosed {
+			logger.Error("serving metrics failed", "err", err)
+		}
+	}()
+
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(ctx)
+	}, nil
+}
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/go-ping/ping"
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv6"
+)
+
+const (
+	// ndHopLimit is the hop limit neighbor discovery messages must carry, so
+	// that they cannot have crossed a router.
+	ndHopLimit = 255
+
+	ndOptionSourceLinkAddr = 1
+	ndOptionTargetLinkAddr = 2
+)
+
+// link is an interface with its IPv6 networks, the on-link ranges neighbor
+// discovery is used for.
+type link struct {
+	iface    *net.Interface
+	networks []*net.IPNet
+}
+
+// ndPinger sends neighbor solicitations to IPv6 addresses on directly attached
+// links and takes the neighbor advertisements as replies, like ARP for IPv4.
+// The target link-layer address of an advertisement becomes a MAC address of
+// the host. Addresses off the local links, IPv4 included, are handed to the
+// fallback pinger. It needs a raw socket, so it only works with root or
+// CAP_NET_RAW.
+type ndPinger struct {
+	opts     Options
+	fallback Pinger
+	links    []link
+	local    map[string]bool
+
+	// macs holds the link-layer addresses of the hosts that answered, nil
+	// for advertisements without one.
+	mu   sync.Mutex
+	macs map[string]net.HardwareAddr
+}
+
+func newNDPinger(opts Options, fallback Pinger) *ndPinger {
+	p := &ndPinger{opts: opts, fallback: fallback, local: make(map[string]bool), macs: make(map[string]net.HardwareAddr)}
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		logger.Warn("listing interfaces for neighbor discovery failed", "err", err)
+	}
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		if opts.Interface != "" && iface.Name != opts.Interface {
+			continue
+		}
+		l := link{iface: &iface}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			logger.Debug("reading interface addresses failed", "iface", iface.Name, "err", err)
+		}
+		for _, addr := range addrs {
+			ipNet, ok := addr.(*net.IPNet)
+			if !ok || ipNet.IP.To4() != nil {
+				continue
+			}
+			p.local[ipNet.IP.String()] = true
+			if !ipNet.IP.IsLinkLocalUnicast() {
+				l.networks = append(l.networks, ipNet)
+			}
+		}
+		p.links = append(p.links, l)
+	}
+	return p
+}
+
+// link returns the local link address is on, or nil if it has to be reached
+// through a router or is one of the local addresses, which do not answer
+// solicitations from this host. Link-local addresses are on every link, so
+// they need Options.Interface to pick one.
+func (p *ndPinger) link(address net.IP) (*link, error) {
+	if address.To4() != nil || p.local[address.String()] {
+		return nil, nil
+	}
+	if address.IsLinkLocalUnicast() {
+		if p.opts.Interface == "" {
+			return nil, &setupError{errors.New("Neighbor discovery of link-local addresses needs -iface")}
+		}
+		if len(p.links) == 0 {
+			return nil, &setupError{fmt.Errorf("Interface %s is down", p.opts.Interface)}
+		}
+		return &p.links[0], nil
+	}
+	for i, l := range p.links {
+		for _, network := range l.networks {
+			if network.Contains(address) {
+				return &p.links[i], nil
+			}
+		}
+	}
+	return nil, nil
+}
+
+func (p *ndPinger) Ping(ctx context.Context, address net.IP, onRecv func(*ping.Packet)) (*ping.Statistics, error) {
+	l, err := p.link(address)
+	if err != nil {
+		return nil, err
+	}
+	if l == nil {
+		return p.fallback.Ping(ctx, address, onRecv)
+	}
+
+	deadline := time.Now().Add(p.opts.Timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+
+	conn, err := icmp.ListenPacket("ip6:ipv6-icmp", "::")
+	if err != nil {
+		return nil, &setupError{fmt.Errorf("Neighbor discovery needs root or CAP_NET_RAW: %w", err)}
+	}
+	defer conn.Close()
+
+	pc := conn.IPv6PacketConn()
+	var filter ipv6.ICMPFilter
+	filter.SetAll(true)
+	filter.Accept(ipv6.ICMPTypeNeighborAdvertisement)
+	if err := pc.SetICMPFilter(&filter); err != nil {
+		return nil, err
+	}
+	if err := pc.SetMulticastHopLimit(ndHopLimit); err != nil {
+		return nil, err
+	}
+	if err := pc.SetMulticastInterface(l.iface); err != nil {
+		return nil, err
+	}
+
+	stop := context.AfterFunc(ctx, func() { conn.SetDeadline(time.Now()) })
+	defer stop()
+
+	request, err := neighborSolicitation(address, l.iface.HardwareAddr)
+	if err != nil {
+		return nil, err
+	}
+	dst := &net.IPAddr{IP: solicitedNodeAddress(address), Zone: l.iface.Name}
+
+	ipAddr := &net.IPAddr{IP: address}
+	stats := &ping.Statistics{IPAddr: ipAddr, Addr: address.String()}
+	reply := make([]byte, 1500)
+
+	attempts := max(p.opts.Count, 1)
+	for attempt := 0; attempt < attempts && ctx.Err() == nil; attempt++ {
+		attemptDeadline := time.Now().Add(time.Until(deadline) / time.Duration(attempts-attempt))
+		conn.SetDeadline(attemptDeadline)
+
+		sent := time.Now()
+		if _, err := conn.WriteTo(request, dst); err != nil {
+			return nil, err
+		}
+		stats.PacketsSent++
+
+		for {
+			n, _, err := conn.ReadFrom(reply)
+			if err != nil {
+				break
+			}
+			mac, ok := parseNeighborAdvertisement(reply[:n], address)
+			if !ok {
+				continue
+			}
+
+			rtt := time.Since(sent)
+			stats.PacketsRecv++
+			stats.Rtts = append(stats.Rtts, rtt)
+			p.mu.Lock()
+			p.macs[address.String()] = mac
+			p.mu.Unlock()
+			if onRecv != nil {
+				onRecv(&ping.Packet{Rtt: rtt, IPAddr: ipAddr, Addr: address.String(), Nbytes: n, Seq: attempt})
+			}
+			break
+		}
+		if stats.PacketsRecv > 0 {
+			break
+		}
+	}
+
+	summarizeStats(stats)
+	return stats, nil
+}
+
+// bytesSent counts neighbor solicitations, or the probes of the fallback for
+// hosts off the links.
+func (p *ndPinger) bytesSent(ip net.IP, stats *ping.Statistics) int {
+	l, err := p.link(ip)
+	if err != nil || l == nil {
+		return countBytes(p.fallback, ip, stats)
+	}
+	request, err := neighborSolicitation(ip, l.iface.HardwareAddr)
+	if err != nil {
+		return 0
+	}
+	return stats.PacketsSent * (ipv6.HeaderLen + len(request))
+}
+
+func (p *ndPinger) addDetails(result *Result) {
+	p.mu.Lock()
+	mac, ok := p.macs[result.IP.String()]
+	delete(p.macs, result.IP.String())
+	p.mu.Unlock()
+
+	if ok {
+		if mac != nil {
+			result.MACs = addMAC(result.MACs, mac)
+		}
+		result.Methods = []string{methodND}
+		return
+	}
+	if detailer, ok := p.fallback.(hostDetailer); ok {
+		detailer.addDetails(result)
+	}
+}
+
+// solicitedNodeAddress returns the multicast address ff02::1:ffXX:XXXX that
+// neighbor solicitations for address are sent to.
+func solicitedNodeAddress(address net.IP) net.IP {
+	ip := net.ParseIP("ff02::1:ff00:0")
+	copy(ip[13:], address.To16()[13:])
+	return ip
+}
+
+// neighborSolicitation asks for the link-layer address of target, giving mac
+// as the address to answer to.
+func neighborSolicitation(target net.IP, mac net.HardwareAddr) ([]byte, error) {
+	body := make([]byte, 4, 4+net.IPv6len+2+len(mac))
+	body = append(body, target.To16()...)
+	if len(mac) > 0 {
+		body = append(body, ndOptionSourceLinkAddr, byte((2+len(mac)+7)/8))
+		body = append(body, mac...)
+		for len(body)%8 != 4 {
+			body = append(body, 0)
+		}
+	}
+	message := icmp.Message{Type: ipv6.ICMPTypeNeighborSolicitation, Body: &icmp.RawBody{Data: body}}
+	return message.Marshal(nil)
+}
+
+// parseNeighborAdvertisement checks that data is a neighbor advertisement for
+// target and returns the link-layer address it carries, if any.
+func parseNeighborAdvertisement(data []byte, target net.IP) (net.HardwareAddr, bool) {
+	message, err := icmp.ParseMessage(ipv6.ICMPTypeNeighborAdvertisement.Protocol(), data)
+	if err != nil || message.Type != ipv6.ICMPTypeNeighborAdvertisement {
+		return nil, false
+	}
+	body, ok := message.Body.(*icmp.RawBody)
+	if !ok || len(body.Data) < 4+net.IPv6len || !bytes.Equal(body.Data[4:4+net.IPv6len], target.To16()) {
+		return nil, false
+	}
+
+	options := body.Data[4+net.IPv6len:]
+	for len(options) >= 8 {
+		length := int(options[1]) * 8
+		if length == 0 || length > len(options) {
+			break
+		}
+		if options[0] == ndOptionTargetLinkAddr {
+			return net.HardwareAddr(bytes.Clone(options[2:length])), true
+		}
+		options = options[length:]
+	}
+	return nil, true
+}
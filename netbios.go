@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/binary"
+	"math/rand"
+	"net"
+	"strings"
+	"time"
+)
+
+const (
+	netbiosPort    = 137
+	netbiosTimeout = time.Second
+)
+
+// netbiosStatusQuery is a node status request for the wildcard name "*",
+// which Windows hosts answer with the names they registered.
+func netbiosStatusQuery(id uint16) []byte {
+	query := make([]byte, 12, 50)
+	binary.BigEndian.PutUint16(query[0:], id)
+	binary.BigEndian.PutUint16(query[4:], 1) // one question
+
+	// "*" padded with zeros to 16 bytes, in first level encoding.
+	name := make([]byte, 16)
+	name[0] = '*'
+	query = append(query, 32)
+	for _, b := range name {
+		query = append(query, 'A'+b>>4, 'A'+b&0x0f)
+	}
+	query = append(query, 0)
+	return append(query, 0x00, 0x21, 0x00, 0x01) // NBSTAT, IN
+}
+
+// lookupNetBIOS asks ip for its NetBIOS computer name. It returns an empty
+// string if the host does not answer in time.
+func lookupNetBIOS(ip net.IP) string {
+	conn, err := net.DialUDP("udp", nil, &net.UDPAddr{IP: ip, Port: netbiosPort})
+	if err != nil {
+		logger.Debug("netbios lookup failed", "ip", ip, "err", err)
+		return ""
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(netbiosTimeout))
+
+	id := uint16(rand.Intn(1 << 16))
+	if _, err := conn.Write(netbiosStatusQuery(id)); err != nil {
+		logger.Debug("netbios lookup failed", "ip", ip, "err", err)
+		return ""
+	}
+
+	buf := make([]byte, 1500)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			logger.Debug("netbios lookup failed", "ip", ip, "err", err)
+			return ""
+		}
+		if name, ok := netbiosName(buf[:n], id); ok {
+			return name
+		}
+	}
+}
+
+// netbiosName returns the unique workstation name from a node status
+// response to the query with the given ID.
+func netbiosName(reply []byte, id uint16) (string, bool) {
+	// Header, the 34 byte encoded name, type, class, TTL and data length.
+	const namesAt = 12 + 34 + 2 + 2 + 4 + 2
+	if len(reply) < namesAt+1 || binary.BigEndian.Uint16(reply) != id || reply[2]&0x80 == 0 {
+		return "", false
+	}
+
+	count := int(reply[namesAt])
+	entries := reply[namesAt+1:]
+	for i := 0; i < count && len(entries) >= 18; i++ {
+		entry := entries[:18]
+		entries = entries[18:]
+
+		suffix, group := entry[15], binary.BigEndian.Uint16(entry[16:])&0x8000 != 0
+		if suffix == 0x00 && !group {
+			return strings.TrimRight(printable(string(entry[:15])), " "), true
+		}
+	}
+	return "", true
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// noteStore keeps a note per IP, such as "printer-lab2", in a JSON file so that
+// it survives between scans. The notes are added to the results of every scan,
+// used or not. A nil noteStore has no notes. It is safe for concurrent use.
+type noteStore struct {
+	mu    sync.Mutex
+	path  string
+	notes map[string]string
+}
+
+// defaultNotesPath returns the file the notes are kept in, or an empty string
+// if there is no config directory.
+func defaultNotesPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "ipdefiner", "notes.json")
+}
+
+// loadNotes reads the notes from path. A missing file starts without notes;
+// an unreadable one is an error, so that saving does not overwrite it.
+func loadNotes(path string) (*noteStore, error) {
+	s := &noteStore{path: path, notes: make(map[string]string)}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read notes: %w", err)
+	}
+	if err := json.Unmarshal(data, &s.notes); err != nil {
+		return nil, fmt.Errorf("Unable to read notes %s: %w", path, err)
+	}
+	return s, nil
+}
+
+// Get returns the note of ip, or an empty string.
+func (s *noteStore) Get(ip net.IP) string {
+	if s == nil {
+		return ""
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.notes[ip.String()]
+}
+
+// Set replaces the note of ip and writes the notes to their file. An empty
+// note removes it.
+func (s *noteStore) Set(ip net.IP, note string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if note == "" {
+		delete(s.notes, ip.String())
+	} else {
+		s.notes[ip.String()] = note
+	}
+
+	data, err := json.MarshalIndent(s.notes, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(s.path, data, 0o644)
+}
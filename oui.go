@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bufio"
+	"encoding/hex"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"sync"
+)
+
+// ouiFiles are copies of the IEEE OUI registry that distributions ship with
+// the ieee-data, nmap and Wireshark packages. The first one found is used.
+var ouiFiles = []string{
+	"/usr/share/ieee-data/oui.txt",
+	"/usr/share/misc/oui.txt",
+	"/usr/share/nmap/nmap-mac-prefixes",
+	"/usr/share/wireshark/manuf",
+}
+
+// knownOUIs names the vendors of common virtual machines and boards when no
+// registry is installed.
+var knownOUIs = map[string]string{
+	"00000c": "Cisco Systems",
+	"000569": "VMware",
+	"000c29": "VMware",
+	"005056": "VMware",
+	"001c42": "Parallels",
+	"00155d": "Microsoft (Hyper-V)",
+	"00163e": "Xensource",
+	"080027": "Oracle VirtualBox",
+	"b827eb": "Raspberry Pi Foundation",
+	"dca632": "Raspberry Pi Trading",
+}
+
+// loadOUIs reads the first registry of ouiFiles, keyed by the lower case hex
+// digits of the OUI. It falls back to knownOUIs.
+var loadOUIs = sync.OnceValue(func() map[string]string {
+	for _, path := range ouiFiles {
+		f, err := os.Open(path)
+		if err != nil {
+			continue
+		}
+		vendors, err := parseOUIs(f)
+		f.Close()
+		if err != nil {
+			logger.Warn("reading the OUI registry failed", "file", path, "err", err)
+			continue
+		}
+		logger.Debug("loaded the OUI registry", "file", path, "vendors", len(vendors))
+		return vendors
+	}
+	return knownOUIs
+})
+
+// parseOUIs reads an OUI registry in the format of the IEEE ("00-00-0C (hex)
+// Cisco Systems, Inc"), nmap ("00000C Cisco Systems") or Wireshark
+// ("00:00:0C<TAB>Cisco<TAB>Cisco Systems, Inc"). Lines that do not start with
+// a 24-bit prefix, such as the longer MA-M and MA-S blocks, are skipped.
+func parseOUIs(r io.Reader) (map[string]string, error) {
+	vendors := make(map[string]string)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		end := strings.IndexAny(line, " \t")
+		if end < 0 {
+			continue
+		}
+		oui := strings.ToLower(strings.NewReplacer("-", "", ":", "").Replace(line[:end]))
+		if _, err := hex.DecodeString(oui); err != nil || len(oui) != 6 {
+			continue
+		}
+		rest := strings.TrimSpace(line[end:])
+		for _, tag := range []string{"(hex)", "(base 16)"} {
+			rest = strings.TrimSpace(strings.TrimPrefix(rest, tag))
+		}
+		// Wireshark has the short name first and the full one after a tab.
+		if _, full, ok := strings.Cut(rest, "\t"); ok {
+			rest = strings.TrimSpace(full)
+		}
+		if rest != "" {
+			vendors[oui] = rest
+		}
+	}
+	return vendors, scanner.Err()
+}
+
+// macVendor returns the vendor the OUI of mac is registered to, or an empty
+// string if it is unknown. Randomized addresses, as phones use them, are
+// locally administered and have no vendor.
+func macVendor(mac net.HardwareAddr) string {
+	if len(mac) < 3 {
+		return ""
+	}
+	if mac[0]&0x02 != 0 {
+		return "locally administered"
+	}
+	return loadOUIs()[hex.EncodeToString(mac[:3])]
+}
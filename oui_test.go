@@ -0,0 +1,35 @@
+package main
+
+import (
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestParseOUIs(t *testing.T) {
+	tests := []struct {
+		name, registry string
+	}{
+		{"ieee", "OUI/MA-L\t\t\tOrganization\n00-00-0C   (hex)\t\tCisco Systems, Inc\n00000C     (base 16)\t\tCisco Systems, Inc\n\t\t\t\tSan Jose  CA  94568\n"},
+		{"nmap", "# comment\n00000C Cisco Systems, Inc\n"},
+		{"wireshark", "00:00:0C\tCisco\tCisco Systems, Inc\n00:1B:C5:00:00/36\tConverging\tConverging Systems Inc.\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vendors, err := parseOUIs(strings.NewReader(tt.registry))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(vendors) != 1 || vendors["00000c"] != "Cisco Systems, Inc" {
+				t.Errorf("parseOUIs = %v, want only 00000c: Cisco Systems, Inc", vendors)
+			}
+		})
+	}
+}
+
+func TestMACVendorLocallyAdministered(t *testing.T) {
+	mac, _ := net.ParseMAC("52:54:00:12:34:56")
+	if vendor := macVendor(mac); vendor != "locally administered" {
+		t.Errorf("macVendor(%s) = %q, want locally administered", mac, vendor)
+	}
+}
@@ -0,0 +1,574 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"net"
+	"os"
+	"os/signal"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+	"unicode/utf8"
+
+	"github.com/samber/lo"
+)
+
+type jsonResult struct {
+	IP         string          `json:"ip"`
+	Blocks     []string        `json:"blocks"`
+	Used       bool            `json:"used"`
+	Status     string          `json:"status"`
+	Hostname   string          `json:"hostname,omitempty"`
+	Note       string          `json:"note,omitempty"`
+	RTTMs      float64         `json:"rtt_ms,omitempty"`
+	JitterMs   float64         `json:"jitter_ms,omitempty"`
+	Confidence float64         `json:"confidence"`
+	MACs       []string        `json:"macs,omitempty"`
+	Lease      string          `json:"lease,omitempty"`
+	TTL        int             `json:"ttl,omitempty"`
+	OSGuess    string          `json:"os_guess,omitempty"`
+	Cached     bool            `json:"cached,omitempty"`
+	Conflict   bool            `json:"conflict,omitempty"`
+	SNMPName   string          `json:"snmp_name,omitempty"`
+	SNMPDescr  string          `json:"snmp_descr,omitempty"`
+	Methods    []string        `json:"methods,omitempty"`
+	Services   []jsonService   `json:"services,omitempty"`
+	Changed    bool            `json:"changed,omitempty"`
+	Ports      map[int]string  `json:"ports,omitempty"`
+	Interfaces map[string]bool `json:"interfaces,omitempty"`
+	Mismatch   bool            `json:"mismatch,omitempty"`
+	Woke       bool            `json:"woke,omitempty"`
+	Error      string          `json:"error,omitempty"`
+	ErrorClass string          `json:"error_class,omitempty"`
+}
+
+type jsonService struct {
+	Port   int    `json:"port"`
+	Banner string `json:"banner,omitempty"`
+}
+
+type jsonMeta struct {
+	CIDR            string    `json:"cidr"`
+	HostCount       int       `json:"host_count"`
+	Excluded        int       `json:"excluded,omitempty"`
+	Started         time.Time `json:"started"`
+	Finished        time.Time `json:"finished"`
+	DurationSeconds float64   `json:"duration_seconds"`
+	NotScanned      int       `json:"not_scanned,omitempty"`
+	Interrupted     bool      `json:"interrupted,omitempty"`
+	PacketsSent     int64     `json:"packets_sent"`
+	BytesSent       int64     `json:"bytes_sent"`
+	Workers         int       `json:"workers,omitempty"`
+}
+
+type jsonGroup struct {
+	Summary Summary      `json:"summary"`
+	Results []jsonResult `json:"results"`
+}
+
+type jsonHeader struct {
+	Targets   []string     `json:"targets"`
+	Meta      jsonMeta     `json:"meta"`
+	Summary   Summary      `json:"summary"`
+	Histogram []Bucket     `json:"histogram,omitempty"`
+	Conflicts []string     `json:"conflicts,omitempty"`
+	Rollup    []rollupLine `json:"rollup,omitempty"`
+
+	// ProxyARP lists the pools where every address answered identically.
+	ProxyARP []string `json:"proxy_arp,omitempty"`
+
+	// Unexpected and Missing compare the used IPs with -expected.
+	Unexpected []string `json:"unexpected,omitempty"`
+	Missing    []string `json:"missing,omitempty"`
+}
+
+// rollupLine has the totals of a single pool.
+type rollupLine struct {
+	CIDR string `json:"cidr"`
+	Summary
+}
+
+type jsonReport struct {
+	jsonHeader
+	Results []jsonResult `json:"results"`
+}
+
+type jsonGroupedReport struct {
+	jsonHeader
+	Groups map[string]jsonGroup `json:"groups"`
+}
+
+// stopOnInterrupt makes Ctrl-C or SIGTERM stop the running scan of analyzer,
+// so that the results so far are written as usual. A second Ctrl-C quits
+// right away. The returned function stops catching the signals.
+func stopOnInterrupt(analyzer *Analyzer, display displayOptions) func() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	interrupt := context.AfterFunc(ctx, func() {
+		stop()
+		if !display.quiet {
+			fmt.Fprintln(os.Stderr, "Interrupted, writing the results so far (Ctrl-C again to quit)")
+		}
+		analyzer.Stop()
+	})
+	return func() {
+		interrupt()
+		stop()
+	}
+}
+
+// runHeadless scans targets once and writes the results in format. The
+// results of an earlier scan, if any, mark the hosts that changed since.
+func runHeadless(w io.Writer, analyzer *Analyzer, targets []string, format string, display displayOptions, previous []Result) ([]Result, error) {
+	defer stopOnInterrupt(analyzer, display)()
+
+	results, meta, err := analyzer.Scan(targets)
+	if err != nil {
+		return nil, err
+	}
+	markChanges(previous, results)
+
+	if display.html != "" {
+		if err := writeHTMLFile(display.html, meta, results, display); err != nil {
+			return nil, err
+		}
+	}
+
+	// The rollup comes before the results; CSV and grepable keep stdout for
+	// the parsers.
+	if display.rollup && !slices.Contains([]string{"json", "jsonl", "rollup"}, format) {
+		out := w
+		if format == "csv" || format == "grepable" {
+			out = os.Stderr
+		}
+		if err := writeRollup(out, rollup(targets, results)); err != nil {
+			return nil, err
+		}
+		if out == w {
+			fmt.Fprintln(w)
+		}
+	}
+
+	switch format {
+	case "json":
+		err = writeJSON(w, targets, meta, results, display)
+	case "rollup":
+		err = writeRollup(w, rollup(targets, results))
+	case "csv":
+		if !display.quiet {
+			fmt.Fprintf(os.Stderr, "Scanned %d addresses of %s at %s%s in %s%s\n",
+				meta.HostCount, meta.CIDR, meta.Started.Format(time.RFC3339), trafficNote(meta), meta.Duration.Round(time.Millisecond), deadlineNote(meta))
+		}
+		err = writeCSV(w, results, display)
+	case "markdown":
+		err = writeMarkdown(w, targets, results, display)
+	case "jsonl":
+		// Every result has already been written by newJSONLWriter; the
+		// summary ends the stream.
+		err = writeJSONLSummary(w, meta, results)
+	case "aggregate":
+		err = writeAggregate(w, results)
+	case "compact":
+		err = writeCompact(w, results, display)
+	case "grepable":
+		err = writeGrepable(w, meta, results, display)
+	case "summary":
+		_, err = fmt.Fprintf(w, "%s in %s, took %s%s\n", summaryLine(Summarize(results)), meta.CIDR, meta.Duration.Round(time.Millisecond), deadlineNote(meta))
+	default:
+		err = fmt.Errorf("Unknown output format: %s", format)
+	}
+
+	if err == nil && format != "json" && !display.quiet {
+		writeWarnings(w, format, targets, results, display)
+	}
+	return results, err
+}
+
+// writeWarnings writes the warnings and the -expected alerts of a scan that
+// was written in format. JSON has them in its header; other formats have no
+// room for them and get them on stderr, but for markdown, which has the
+// alerts in a section of its own.
+func writeWarnings(w io.Writer, format string, targets []string, results []Result, display displayOptions) {
+	writeProxyARPWarnings(os.Stderr, proxyARPBlocks(targets, results))
+	if mismatches := Summarize(results).Mismatches; mismatches > 0 {
+		fmt.Fprintln(os.Stderr, mismatchWarning(mismatches))
+	}
+	writeWokeHosts(os.Stderr, results)
+	writeErrorClasses(os.Stderr, Summarize(results))
+
+	if display.expected != nil {
+		if format == "markdown" {
+			writeExpectedAlerts(w, results, display.expected, "### ")
+		} else {
+			writeExpectedAlerts(os.Stderr, results, display.expected, "")
+		}
+	}
+}
+
+func writeJSON(w io.Writer, targets []string, meta ScanMeta, results []Result, display displayOptions) error {
+	header := jsonHeader{
+		Targets: targets,
+		Summary: Summarize(results),
+		Meta:    toJSONMeta(meta),
+	}
+	if display.hist {
+		header.Histogram = Histogram(results)
+	}
+	if display.rollup {
+		header.Rollup = rollup(targets, results)
+	}
+	header.ProxyARP = proxyARPBlocks(targets, results)
+	for _, result := range visibleResults(results, display) {
+		if result.Conflict() {
+			header.Conflicts = append(header.Conflicts, result.IP.String())
+		}
+	}
+	if display.expected != nil {
+		unexpected, missing := compareExpected(results, display.expected)
+		header.Unexpected, header.Missing = ipStrings(unexpected), ipStrings(missing)
+	}
+
+	var report any = jsonReport{
+		jsonHeader: header,
+		Results:    toJSONResults(visibleResults(results, display)),
+	}
+	if display.grouped(targets) {
+		blocks := canonicalBlocks(targets)
+		groups := groupByBlock(results)
+		grouped := jsonGroupedReport{jsonHeader: header, Groups: make(map[string]jsonGroup)}
+		for _, block := range blocks {
+			grouped.Groups[block] = jsonGroup{
+				Summary: Summarize(groups[block]),
+				Results: toJSONResults(visibleResults(groups[block], display)),
+			}
+		}
+		report = grouped
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(report)
+}
+
+func toJSONMeta(meta ScanMeta) jsonMeta {
+	return jsonMeta{
+		CIDR:            meta.CIDR,
+		HostCount:       meta.HostCount,
+		Excluded:        meta.Excluded,
+		Started:         meta.Started,
+		Finished:        meta.Finished,
+		DurationSeconds: meta.Duration.Seconds(),
+		NotScanned:      meta.NotScanned,
+		Interrupted:     meta.Interrupted,
+		PacketsSent:     meta.PacketsSent,
+		BytesSent:       meta.BytesSent,
+		Workers:         meta.Workers,
+	}
+}
+
+// newJSONLWriter returns an Options.OnResult callback that writes every
+// result as a line of JSON, in the order the results arrive.
+func newJSONLWriter(w io.Writer, display displayOptions) func(Result) {
+	return func(result Result) {
+		if display.onlyUsed && !result.Used {
+			return
+		}
+		line, err := json.Marshal(toJSONResult(result))
+		if err != nil {
+			logger.Error("encoding result failed", "ip", result.IP, "err", err)
+			return
+		}
+		if _, err := w.Write(append(line, '\n')); err != nil {
+			logger.Error("writing result failed", "ip", result.IP, "err", err)
+		}
+	}
+}
+
+// jsonlSummary is the last line of the jsonl format.
+type jsonlSummary struct {
+	Meta    jsonMeta `json:"meta"`
+	Summary Summary  `json:"summary"`
+}
+
+func writeJSONLSummary(w io.Writer, meta ScanMeta, results []Result) error {
+	line, err := json.Marshal(jsonlSummary{Meta: toJSONMeta(meta), Summary: Summarize(results)})
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(line, '\n'))
+	return err
+}
+
+func toJSONResults(results []Result) []jsonResult {
+	converted := []jsonResult{}
+	for _, result := range results {
+		converted = append(converted, toJSONResult(result))
+	}
+	return converted
+}
+
+func toJSONResult(result Result) jsonResult {
+	r := jsonResult{
+		IP:         result.IP.String(),
+		Blocks:     result.Blocks,
+		Used:       result.Used,
+		Status:     result.Status().String(),
+		Hostname:   result.Hostname,
+		Note:       result.Note,
+		RTTMs:      float64(result.RTT) / float64(time.Millisecond),
+		JitterMs:   float64(result.Jitter) / float64(time.Millisecond),
+		Confidence: result.Confidence,
+	}
+	for _, mac := range result.MACs {
+		r.MACs = append(r.MACs, mac.String())
+	}
+	r.Lease = result.Lease
+	r.TTL = result.TTL
+	r.OSGuess = result.OSGuess()
+	r.Cached = result.Cached
+	r.Conflict = result.Conflict()
+	r.SNMPName, r.SNMPDescr = result.SNMP.Name, result.SNMP.Descr
+	r.Methods = result.Methods
+	r.Changed = result.Changed
+	r.Ports = result.Ports
+	r.Interfaces, r.Mismatch = result.Interfaces, result.Mismatch()
+	r.Woke = result.Woke
+	for _, service := range result.Services {
+		r.Services = append(r.Services, jsonService{Port: service.Port, Banner: service.Banner})
+	}
+	if result.Err != nil {
+		r.Error, r.ErrorClass = result.Err.Error(), result.ErrorClass()
+	}
+	return r
+}
+
+// writeWokeHosts lists the IPs that only answered after the warm-up, if any.
+func writeWokeHosts(w io.Writer, results []Result) {
+	var woke []net.IP
+	for _, result := range results {
+		if result.Woke {
+			woke = append(woke, result.IP)
+		}
+	}
+	if len(woke) == 0 {
+		return
+	}
+	slices.SortFunc(woke, compareIPs)
+	fmt.Fprintf(w, "Answered only after the warm-up (%d):\n", len(woke))
+	for _, ip := range woke {
+		fmt.Fprintf(w, "- %s\n", ip)
+	}
+}
+
+// writeErrorClasses counts the unknown IPs by the class of their error, most
+// common first, if there are any.
+func writeErrorClasses(w io.Writer, summary Summary) {
+	if summary.Unknown == 0 {
+		return
+	}
+	classes := slices.Collect(maps.Keys(summary.ErrorClasses))
+	slices.SortFunc(classes, func(a, b string) int {
+		return cmp.Or(cmp.Compare(summary.ErrorClasses[b], summary.ErrorClasses[a]), strings.Compare(a, b))
+	})
+	fmt.Fprintf(w, "Unknown IPs by error (%d):\n", summary.Unknown)
+	for _, class := range classes {
+		fmt.Fprintf(w, "- %d: %s\n", summary.ErrorClasses[class], class)
+	}
+}
+
+// writeCompact writes a line per IP saying whether it is up, for quick checks
+// of single hosts.
+func writeCompact(w io.Writer, results []Result, display displayOptions) error {
+	for _, result := range visibleResults(results, display) {
+		name := result.IP.String()
+		if result.Hostname != "" {
+			name += " (" + result.Hostname + ")"
+		}
+		var err error
+		switch {
+		case result.Err != nil:
+			_, err = fmt.Fprintf(w, "%s is unknown: %s\n", name, result.Err)
+		case result.Used:
+			only := ""
+			if result.Mismatch() {
+				only = " only on " + strings.Join(answeredOn(result), ", ")
+			}
+			if result.Woke {
+				only += " after the warm-up"
+			}
+			if result.Changed {
+				only += " (was down)"
+			}
+			_, err = fmt.Fprintf(w, "%s is up%s, rtt %s\n", name, only, result.RTT.Round(10*time.Microsecond))
+		case result.Changed:
+			_, err = fmt.Fprintf(w, "%s is down (was up)\n", name)
+		default:
+			_, err = fmt.Fprintf(w, "%s is down\n", name)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rollup returns the totals of every pool in targets, in their order.
+func rollup(targets []string, results []Result) []rollupLine {
+	groups := groupByBlock(results)
+	var lines []rollupLine
+	for _, block := range canonicalBlocks(targets) {
+		lines = append(lines, rollupLine{CIDR: block, Summary: Summarize(groups[block])})
+	}
+	return lines
+}
+
+// writeRollup writes a line per pool, such as "10.0.0.0/24  12 used, 242
+// free of 254", with the totals lined up.
+func writeRollup(w io.Writer, lines []rollupLine) error {
+	width := 0
+	for _, line := range lines {
+		width = max(width, len(line.CIDR))
+	}
+	for _, line := range lines {
+		if _, err := fmt.Fprintf(w, "%-*s  %s\n", width, line.CIDR, summaryLine(line.Summary)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeAggregate(w io.Writer, results []Result) error {
+	var used []net.IP
+	for _, result := range results {
+		if result.Used {
+			used = append(used, result.IP)
+		}
+	}
+	for _, block := range aggregate(used) {
+		if _, err := fmt.Fprintln(w, block); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeCSV(w io.Writer, results []Result, display displayOptions) error {
+	cw := csv.NewWriter(w)
+	if !display.quiet {
+		cw.Write([]string{"ip", "status", "hostname", "rtt_ms", "macs", "lease", "ttl", "os_guess", "ports", "interfaces", "error", "note"})
+	}
+	for _, result := range visibleResults(results, display) {
+		r := toJSONResult(result)
+		rtt, ttl := "", ""
+		if result.Used {
+			rtt = strconv.FormatFloat(r.RTTMs, 'f', 3, 64)
+		}
+		if r.TTL > 0 {
+			ttl = strconv.Itoa(r.TTL)
+		}
+		var ports []string
+		for _, service := range result.Services {
+			ports = append(ports, strconv.Itoa(service.Port))
+		}
+		var ifaces []string
+		for _, name := range interfaceNames([]Result{result}) {
+			ifaces = append(ifaces, name+":"+usedText(result.Interfaces[name]))
+		}
+		cw.Write([]string{r.IP, statusText(result), r.Hostname, rtt, strings.Join(r.MACs, " "), r.Lease, ttl, r.OSGuess, strings.Join(ports, " "), strings.Join(ifaces, " "), r.Error, r.Note})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func writeMarkdown(w io.Writer, targets []string, results []Result, display displayOptions) error {
+	if !display.grouped(targets) || display.quiet {
+		return writeMarkdownTable(w, results, display)
+	}
+
+	fmt.Fprintf(w, "All pools: %s\n\n", summaryLine(Summarize(results)))
+	blocks := canonicalBlocks(targets)
+	groups := groupByBlock(results)
+	for i, block := range blocks {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintf(w, "### %s\n\n%s\n\n", block, summaryLine(Summarize(groups[block])))
+		if err := writeMarkdownTable(w, groups[block], display); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeMarkdownTable(w io.Writer, results []Result, display displayOptions) error {
+	// With several interfaces, their results are shown side by side.
+	ifaces := interfaceNames(results)
+	rows := [][]string{append([]string{"IP", "Status", "Hostname", "RTT"}, ifaces...)}
+	shown := visibleResults(results, display)
+	notes := slices.ContainsFunc(shown, func(r Result) bool { return r.Note != "" })
+	if notes {
+		rows[0] = append(rows[0], "Note")
+	}
+	for _, result := range shown {
+		rtt := ""
+		if result.Used {
+			rtt = result.RTT.Round(10 * time.Microsecond).String()
+		}
+		row := []string{result.IP.String(), statusText(result), markdownText(result.Hostname), rtt}
+		for _, name := range ifaces {
+			answered, probed := result.Interfaces[name]
+			row = append(row, lo.Ternary(probed, usedText(answered), ""))
+		}
+		if notes {
+			row = append(row, markdownText(result.Note))
+		}
+		rows = append(rows, row)
+	}
+
+	widths := make([]int, len(rows[0]))
+	for _, row := range rows {
+		for i, cell := range row {
+			widths[i] = max(widths[i], utf8.RuneCountInString(cell), 3)
+		}
+	}
+
+	writeRow := func(cells []string) error {
+		line := "|"
+		for i, cell := range cells {
+			line += fmt.Sprintf(" %-*s |", widths[i], cell)
+		}
+		_, err := fmt.Fprintln(w, line)
+		return err
+	}
+
+	if err := writeRow(rows[0]); err != nil {
+		return err
+	}
+	separator := make([]string, len(widths))
+	for i, width := range widths {
+		separator[i] = strings.Repeat("-", width)
+	}
+	if err := writeRow(separator); err != nil {
+		return err
+	}
+	for _, row := range rows[1:] {
+		if err := writeRow(row); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// markdownText shortens free text such as a hostname like the TUI does, so a
+// long one cannot stretch the table, and escapes it for a cell.
+func markdownText(s string) string {
+	return strings.ReplaceAll(truncate(s, maxNameWidth), "|", "\\|")
+}
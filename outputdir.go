@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// maxRunNameWidth keeps file names of scans with many pools within the limits
+// of file systems.
+const maxRunNameWidth = 100
+
+// runFileName returns the name of the files of a scan without extension, for
+// example scan-10.0.0.0_24-20240502T101500Z.
+func runFileName(meta ScanMeta) string {
+	pools := strings.NewReplacer("/", "_", ":", "-", ", ", "+").Replace(meta.CIDR)
+	if len(pools) > maxRunNameWidth {
+		pools = pools[:maxRunNameWidth]
+	}
+	return fmt.Sprintf("scan-%s-%s", pools, meta.Finished.UTC().Format("20060102T150405Z"))
+}
+
+// writeRunFiles writes the results of a scan to dir: always as JSON, and also
+// in the headless format and as HTML report if those are chosen. It returns
+// the files written.
+func writeRunFiles(dir string, meta ScanMeta, results []Result, format string, display displayOptions) ([]string, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("Unable to create output directory: %w", err)
+	}
+
+	targets := strings.Split(meta.CIDR, ", ")
+	writers := map[string]func(io.Writer) error{
+		".json": func(w io.Writer) error { return writeJSON(w, targets, meta, results, display) },
+	}
+	switch format {
+	case "csv":
+		writers[".csv"] = func(w io.Writer) error { return writeCSV(w, results, display) }
+	case "markdown":
+		writers[".md"] = func(w io.Writer) error { return writeMarkdown(w, targets, results, display) }
+	}
+	if display.html != "" {
+		writers[".html"] = func(w io.Writer) error { return writeHTML(w, meta, results, display) }
+	}
+
+	base := filepath.Join(dir, runFileName(meta))
+	var written []string
+	for _, ext := range []string{".json", ".csv", ".md", ".html"} {
+		write, ok := writers[ext]
+		if !ok {
+			continue
+		}
+		if err := writeFile(base+ext, write); err != nil {
+			return written, err
+		}
+		written = append(written, base+ext)
+	}
+	return written, nil
+}
+
+func writeFile(path string, write func(io.Writer) error) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("Unable to write %s: %w", path, err)
+	}
+	defer f.Close()
+
+	if err := write(f); err != nil {
+		return fmt.Errorf("Unable to write %s: %w", path, err)
+	}
+	return f.Close()
+}
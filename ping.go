@@ -0,0 +1,221 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/go-ping/ping"
+	"github.com/samber/lo"
+	"golang.org/x/net/icmp"
+)
+
+// Pinger sends echo requests to a single address until it is done or ctx
+// expires. onRecv, when not nil, is called for every reply before Ping
+// returns.
+type Pinger interface {
+	Ping(ctx context.Context, ip net.IP, onRecv func(*ping.Packet)) (*ping.Statistics, error)
+}
+
+// setupError marks errors that will fail every probe of a scan, such as a
+// misconfigured interface, as opposed to a single unreachable host.
+type setupError struct {
+	err error
+}
+
+func (e *setupError) Error() string {
+	return e.err.Error()
+}
+
+func (e *setupError) Unwrap() error {
+	return e.err
+}
+
+func isSetupError(err error) bool {
+	var setupErr *setupError
+	return errors.As(err, &setupErr) || errors.Is(err, os.ErrPermission) || errors.Is(err, syscall.EMSGSIZE)
+}
+
+// confidence returns the share of the probes in stats that were answered.
+// Duplicate replies do not raise it above 1.
+func confidence(stats *ping.Statistics) float64 {
+	if stats == nil || stats.PacketsSent == 0 {
+		return 0
+	}
+	return min(float64(stats.PacketsRecv)/float64(stats.PacketsSent), 1)
+}
+
+// summarizeStats fills in the round-trip times and the packet loss of stats
+// from its counters and samples, for pingers that collect them by hand.
+func summarizeStats(stats *ping.Statistics) {
+	stats.MinRtt, stats.MaxRtt, stats.AvgRtt = 0, 0, 0
+	if len(stats.Rtts) > 0 {
+		var total time.Duration
+		stats.MinRtt = stats.Rtts[0]
+		for _, rtt := range stats.Rtts {
+			total += rtt
+			stats.MinRtt = min(stats.MinRtt, rtt)
+			stats.MaxRtt = max(stats.MaxRtt, rtt)
+		}
+		stats.AvgRtt = total / time.Duration(len(stats.Rtts))
+	}
+	if stats.PacketsSent > 0 {
+		stats.PacketLoss = float64(stats.PacketsSent-stats.PacketsRecv) / float64(stats.PacketsSent) * 100
+	}
+}
+
+// repairStats makes the counters of stats agree with its round-trip times,
+// which a pinger that ran into an internal error may have left zeroed, and
+// reports whether stats tells anything about the host. Without statistics or
+// with no probe sent nor reply received it does not: the host is neither
+// known to be used nor known to be free.
+func repairStats(stats *ping.Statistics) bool {
+	if stats == nil {
+		return false
+	}
+	if stats.PacketsRecv < len(stats.Rtts) || stats.PacketsSent < stats.PacketsRecv {
+		stats.PacketsRecv = max(stats.PacketsRecv, len(stats.Rtts))
+		stats.PacketsSent = max(stats.PacketsSent, stats.PacketsRecv)
+		summarizeStats(stats)
+	}
+	return stats.PacketsSent > 0
+}
+
+// ICMP socket modes for Options.ICMPMode.
+const (
+	icmpAuto         = "auto"
+	icmpRaw          = "raw"
+	icmpUnprivileged = "unprivileged"
+)
+
+type icmpPinger struct {
+	opts Options
+
+	// sources and sourceErrs are keyed by whether the family is IPv4.
+	sources    map[bool]string
+	sourceErrs map[bool]error
+
+	// privileged caches the socket mode per family once it is known.
+	mu         sync.Mutex
+	privileged map[bool]bool
+}
+
+func newICMPPinger(opts Options) *icmpPinger {
+	p := &icmpPinger{
+		opts:       opts,
+		sources:    make(map[bool]string),
+		sourceErrs: make(map[bool]error),
+		privileged: make(map[bool]bool),
+	}
+	if opts.Interface != "" {
+		for _, v4 := range []bool{true, false} {
+			source, err := interfaceAddress(opts.Interface, v4)
+			if err != nil {
+				p.sourceErrs[v4] = err
+				continue
+			}
+			p.sources[v4] = source.String()
+		}
+	}
+	return p
+}
+
+func (p *icmpPinger) Ping(ctx context.Context, address net.IP, onRecv func(*ping.Packet)) (*ping.Statistics, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	v4 := address.To4() != nil
+	if err := p.sourceErrs[v4]; err != nil {
+		return nil, &setupError{err}
+	}
+
+	pinger := ping.New(address.String())
+	pinger.SetLogger(pingLogger{})
+	pinger.SetPrivileged(p.usePrivileged(v4))
+
+	pinger.Count = max(p.opts.Count, 1)
+	// go-ping needs a positive interval for its ticker.
+	pinger.Interval = max(p.opts.Interval, time.Nanosecond)
+	pinger.Timeout = p.opts.Timeout
+	if deadline, ok := ctx.Deadline(); ok {
+		pinger.Timeout = max(min(pinger.Timeout, time.Until(deadline)), time.Nanosecond)
+	}
+	pinger.Size = p.opts.Size
+	pinger.Source = p.sources[v4]
+	pinger.OnRecv = onRecv
+
+	stop := context.AfterFunc(ctx, pinger.Stop)
+	defer stop()
+
+	started := time.Now()
+	err := pinger.Run()
+	logger.Debug("probe finished",
+		"ip", address,
+		"sent", pinger.PacketsSent,
+		"recv", pinger.PacketsRecv,
+		"took", time.Since(started),
+		"err", err)
+	if errors.Is(err, syscall.EMSGSIZE) {
+		return nil, fmt.Errorf("Ping size %d is too large: %w", p.opts.Size, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return pinger.Statistics(), nil
+}
+
+// bytesSent counts echo requests: IP and ICMP headers and -size bytes of
+// payload.
+func (p *icmpPinger) bytesSent(ip net.IP, stats *ping.Statistics) int {
+	const icmpHeader = 8
+	return stats.PacketsSent * (ipHeaderLen(ip) + icmpHeader + p.opts.Size)
+}
+
+// usePrivileged reports whether to ping the family with raw sockets. In auto
+// mode raw sockets are preferred, and unprivileged ICMP datagram sockets,
+// which Linux allows for the groups in net.ipv4.ping_group_range, are the
+// fallback. If neither can be opened raw sockets are used, so the error
+// explains that root or CAP_NET_RAW is missing.
+func (p *icmpPinger) usePrivileged(v4 bool) bool {
+	switch p.opts.ICMPMode {
+	case icmpRaw:
+		return true
+	case icmpUnprivileged:
+		return false
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if privileged, ok := p.privileged[v4]; ok {
+		return privileged
+	}
+
+	family := lo.If(v4, "IPv4").Else("IPv6")
+	raw, datagram := lo.If(v4, "ip4:icmp").Else("ip6:ipv6-icmp"), lo.If(v4, "udp4").Else("udp6")
+	privileged := true
+	if err := canListen(raw); err == nil {
+		logger.Info("using raw ICMP sockets", "family", family)
+	} else if err := canListen(datagram); err == nil {
+		logger.Info("raw ICMP sockets are not permitted, using unprivileged ICMP", "family", family)
+		privileged = false
+	} else {
+		logger.Info("neither raw nor unprivileged ICMP sockets are permitted", "family", family, "err", err)
+	}
+	p.privileged[v4] = privileged
+	return privileged
+}
+
+func canListen(network string) error {
+	conn, err := icmp.ListenPacket(network, "")
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
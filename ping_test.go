@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/go-ping/ping"
+)
+
+// statsPinger answers with a copy of the statistics of stats by IP, as a
+// pinger that ran into an internal error may leave them.
+type statsPinger map[string]*ping.Statistics
+
+func (p statsPinger) Ping(ctx context.Context, ip net.IP, onRecv func(*ping.Packet)) (*ping.Statistics, error) {
+	stats := p[ip.String()]
+	if stats == nil {
+		return nil, nil
+	}
+	copied := *stats
+	return &copied, nil
+}
+
+func TestRepairStats(t *testing.T) {
+	ms := time.Millisecond
+	tests := []struct {
+		name       string
+		stats      *ping.Statistics
+		ok         bool
+		sent, recv int
+		loss       float64
+		rtt        time.Duration
+		confidence float64
+	}{
+		{
+			name: "no statistics",
+		},
+		{
+			name:  "nothing sent",
+			stats: &ping.Statistics{},
+		},
+		{
+			name:       "complete",
+			stats:      &ping.Statistics{PacketsSent: 4, PacketsRecv: 2, Rtts: []time.Duration{2 * ms, 4 * ms}, AvgRtt: 3 * ms, PacketLoss: 50},
+			ok:         true,
+			sent:       4,
+			recv:       2,
+			loss:       50,
+			rtt:        3 * ms,
+			confidence: 0.5,
+		},
+		{
+			name:       "counters left zeroed",
+			stats:      &ping.Statistics{Rtts: []time.Duration{ms, 3 * ms, 5 * ms}},
+			ok:         true,
+			sent:       3,
+			recv:       3,
+			rtt:        3 * ms,
+			confidence: 1,
+		},
+		{
+			name:       "replies missing from the counters",
+			stats:      &ping.Statistics{PacketsSent: 4, PacketsRecv: 1, Rtts: []time.Duration{2 * ms, 6 * ms}},
+			ok:         true,
+			sent:       4,
+			recv:       2,
+			loss:       50,
+			rtt:        4 * ms,
+			confidence: 0.5,
+		},
+		{
+			name:       "more received than sent",
+			stats:      &ping.Statistics{PacketsSent: 1, PacketsRecv: 2, Rtts: []time.Duration{2 * ms, 2 * ms}},
+			ok:         true,
+			sent:       2,
+			recv:       2,
+			rtt:        2 * ms,
+			confidence: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stats := tt.stats
+			if ok := repairStats(stats); ok != tt.ok {
+				t.Fatalf("repairStats = %t, want %t", ok, tt.ok)
+			}
+			if !tt.ok {
+				return
+			}
+			if stats.PacketsSent != tt.sent || stats.PacketsRecv != tt.recv {
+				t.Errorf("%d sent and %d received, want %d and %d", stats.PacketsSent, stats.PacketsRecv, tt.sent, tt.recv)
+			}
+			if stats.PacketLoss != tt.loss {
+				t.Errorf("loss = %v%%, want %v%%", stats.PacketLoss, tt.loss)
+			}
+			if stats.AvgRtt != tt.rtt {
+				t.Errorf("average RTT = %v, want %v", stats.AvgRtt, tt.rtt)
+			}
+			if got := confidence(stats); got != tt.confidence {
+				t.Errorf("confidence = %v, want %v", got, tt.confidence)
+			}
+		})
+	}
+}
+
+func TestScanPartialStats(t *testing.T) {
+	ms := time.Millisecond
+	pinger := statsPinger{
+		"10.0.0.1": {Rtts: []time.Duration{2 * ms, 4 * ms}},
+		"10.0.0.2": {PacketsSent: 4, PacketsRecv: 1, Rtts: []time.Duration{ms, 3 * ms}},
+		"10.0.0.3": {},
+		"10.0.0.5": {PacketsSent: 2},
+	}
+	results, _, err := NewAnalizer(Options{Pinger: pinger, Timeout: time.Second}).Scan([]string{"10.0.0.0/29"})
+	if err != nil {
+		t.Fatalf("Scan: %v", err)
+	}
+	want := map[string]struct {
+		status     Status
+		rtt        time.Duration
+		confidence float64
+	}{
+		"10.0.0.1": {StatusUsed, 3 * ms, 1},
+		"10.0.0.2": {StatusUsed, 2 * ms, 0.5},
+		"10.0.0.3": {StatusUnknown, 0, 0},
+		"10.0.0.4": {StatusUnknown, 0, 0},
+		"10.0.0.5": {StatusFree, 0, 0},
+		"10.0.0.6": {StatusUnknown, 0, 0},
+	}
+	for _, result := range results {
+		w := want[result.IP.String()]
+		if result.Status() != w.status || result.RTT != w.rtt || result.Confidence != w.confidence {
+			t.Errorf("%s is %s with an RTT of %v and a confidence of %v, want %s, %v and %v",
+				result.IP, result.Status(), result.RTT, result.Confidence, w.status, w.rtt, w.confidence)
+		}
+		if w.status == StatusUnknown && !errors.Is(result.Err, errNoStatistics) {
+			t.Errorf("%s failed with %v, want %v", result.IP, result.Err, errNoStatistics)
+		}
+	}
+}
+
+// sizedPinger is a statsPinger whose probes have size bytes.
+type sizedPinger struct {
+	statsPinger
+	size int
+}
+
+func (p sizedPinger) bytesSent(ip net.IP, stats *ping.Statistics) int {
+	return stats.PacketsSent * p.size
+}
+
+func TestCountBytes(t *testing.T) {
+	v4, v6 := net.ParseIP("192.0.2.1"), net.ParseIP("2001:db8::1")
+	sent := func(packets int) *ping.Statistics { return &ping.Statistics{PacketsSent: packets} }
+
+	tests := []struct {
+		name   string
+		pinger Pinger
+		ip     net.IP
+		stats  *ping.Statistics
+		want   int
+	}{
+		{"echo request", newICMPPinger(Options{Size: 56}), v4, sent(3), 3 * (20 + 8 + 56)},
+		{"echo request over IPv6", newICMPPinger(Options{Size: 56}), v6, sent(1), 40 + 8 + 56},
+		{"tcp syn", newTCPPinger(Options{TCPPorts: []int{22, 443}}), v4, sent(2), 2 * (20 + 40)},
+		{"empty udp datagram", newUDPPinger(Options{UDPPort: 9}), v4, sent(2), 2 * (20 + 8)},
+		{"unknown pinger", statsPinger{}, v4, sent(2), 0},
+		{"no statistics", newTCPPinger(Options{}), v4, nil, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := countBytes(tt.pinger, tt.ip, tt.stats); got != tt.want {
+				t.Errorf("countBytes() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("probes of several sizes", func(t *testing.T) {
+		stats := statsPinger{v4.String(): sent(2)}
+		pinger := newMultiPinger([]namedPinger{
+			{methodTCP, sizedPinger{stats, 60}},
+			{methodICMP, sizedPinger{stats, 84}},
+		})
+		merged, err := pinger.Ping(context.Background(), v4, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := countBytes(pinger, v4, merged), 2*60+2*84; got != want {
+			t.Errorf("countBytes() = %d, want %d", got, want)
+		}
+		if got := countBytes(pinger, v4, merged); got != 0 {
+			t.Errorf("countBytes() after the first call = %d, want 0", got)
+		}
+	})
+}
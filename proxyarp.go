@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"time"
+)
+
+const (
+	// proxyARPMinHosts is the number of used IPs a pool needs before its
+	// answers are judged at all.
+	proxyARPMinHosts = 8
+	// proxyARPMinShare is the share of the pool that has to be used.
+	proxyARPMinShare = 0.9
+	// Round-trip times within proxyARPSpread of the median, or within
+	// proxyARPMinSpread for very short ones, count as identical.
+	proxyARPSpread    = 0.5
+	proxyARPMinSpread = 100 * time.Microsecond
+)
+
+// proxyARPBlocks returns the pools of targets whose answers look like they
+// all came from the same device, as happens when a router proxy-ARPs for the
+// whole range: (nearly) every IP is used and the used IPs either share a
+// single MAC address or, without -arp, most of them answer with nearly the
+// same round-trip time.
+func proxyARPBlocks(targets []string, results []Result) []string {
+	groups := groupByBlock(results)
+	var blocks []string
+	for _, block := range canonicalBlocks(targets) {
+		if proxyARPSuspect(groups[block]) {
+			blocks = append(blocks, block)
+		}
+	}
+	return blocks
+}
+
+func proxyARPSuspect(results []Result) bool {
+	var (
+		used int
+		rtts []time.Duration
+		macs = make(map[string]bool)
+	)
+	for _, result := range results {
+		if !result.Used {
+			continue
+		}
+		used++
+		rtts = append(rtts, result.RTT)
+		for _, mac := range result.MACs {
+			macs[mac.String()] = true
+		}
+	}
+	if used < proxyARPMinHosts || float64(used) < proxyARPMinShare*float64(len(results)) {
+		return false
+	}
+
+	if len(macs) > 0 {
+		return len(macs) == 1
+	}
+	slices.Sort(rtts)
+	median := rtts[len(rtts)/2]
+	spread := max(time.Duration(proxyARPSpread*float64(median)), proxyARPMinSpread)
+	identical := 0
+	for _, rtt := range rtts {
+		if rtt >= median-spread && rtt <= median+spread {
+			identical++
+		}
+	}
+	return float64(identical) >= proxyARPMinShare*float64(used)
+}
+
+// proxyARPWarning is the warning shown for a pool found by proxyARPBlocks.
+func proxyARPWarning(block string) string {
+	return fmt.Sprintf("Possible proxy ARP in %s: all addresses answered identically", block)
+}
+
+func writeProxyARPWarnings(w io.Writer, blocks []string) {
+	for _, block := range blocks {
+		fmt.Fprintln(w, proxyARPWarning(block))
+	}
+}
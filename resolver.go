@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// defaultDNSTimeout limits reverse lookups unless -dns-timeout is given.
+const defaultDNSTimeout = 2 * time.Second
+
+const (
+	// hostnameCacheTTL is how long the answer of a reverse lookup is reused,
+	// so that repeated scans do not ask for the same names again.
+	hostnameCacheTTL = 10 * time.Minute
+	// hostnameCacheSize is the number of IPs whose names are kept at most.
+	hostnameCacheSize = 4096
+)
+
+// parseDNSServer checks a DNS server given as an IP, optionally with a port,
+// and returns it as host:port, port 53 by default.
+func parseDNSServer(server string) (string, error) {
+	host, port := server, "53"
+	if h, p, err := net.SplitHostPort(server); err == nil {
+		host, port = h, p
+	}
+	if net.ParseIP(host) == nil {
+		return "", fmt.Errorf("Invalid DNS server %q: must be an IP address, optionally with a port", server)
+	}
+	if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+		return "", fmt.Errorf("Invalid DNS server %q: invalid port %s", server, port)
+	}
+	return net.JoinHostPort(host, port), nil
+}
+
+// newResolver returns a resolver that sends every query to server instead of
+// the ones the system is configured with.
+func newResolver(server string) *net.Resolver {
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, server)
+		},
+	}
+}
+
+// addrResolver looks up the names of an address, as *net.Resolver does.
+type addrResolver interface {
+	LookupAddr(ctx context.Context, addr string) ([]string, error)
+}
+
+// hostnameResolver looks up the hostnames of IPs by their PTR records. With a
+// DNS server of its own it switches to the system resolver for good once that
+// server cannot be reached, so that a dead server only costs its timeout once
+// rather than for every host.
+type hostnameResolver struct {
+	server  string
+	custom  addrResolver
+	system  addrResolver
+	timeout time.Duration
+
+	unreachable atomic.Bool
+	cache       *hostnameCache
+}
+
+// newHostnameResolver returns a resolver that asks server, or the system
+// resolver if server is empty.
+func newHostnameResolver(server string, timeout time.Duration) *hostnameResolver {
+	r := &hostnameResolver{server: server, system: net.DefaultResolver, timeout: timeout, cache: newHostnameCache(hostnameCacheTTL, hostnameCacheSize)}
+	if server != "" {
+		r.custom = newResolver(server)
+	}
+	return r
+}
+
+// lookup returns the first name of ip, or an empty string if it has none.
+// Answers, including that there is no name, are cached; failed lookups are
+// not.
+func (r *hostnameResolver) lookup(ip net.IP) string {
+	if name, ok := r.cache.Get(ip); ok {
+		return name
+	}
+	name, err := r.resolve(ip)
+	if err == nil {
+		r.cache.Put(ip, name)
+	}
+	return name
+}
+
+// resolve asks the DNS for the first name of ip. It returns an empty string
+// without an error if ip has no name.
+func (r *hostnameResolver) resolve(ip net.IP) (string, error) {
+	custom := r.custom != nil && !r.unreachable.Load()
+	resolver := r.system
+	if custom {
+		resolver = r.custom
+	}
+
+	names, err := r.lookupAddr(resolver, ip)
+	var dnsErr *net.DNSError
+	if custom && err != nil && !(errors.As(err, &dnsErr) && dnsErr.IsNotFound) {
+		if !r.unreachable.Swap(true) {
+			logger.Warn("DNS server unreachable, using the system resolver", "server", r.server, "err", err)
+		}
+		names, err = r.lookupAddr(r.system, ip)
+	}
+	if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+		err = nil
+	}
+	if err != nil || len(names) == 0 {
+		logger.Debug("reverse lookup failed", "ip", ip, "err", err)
+		return "", err
+	}
+
+	return strings.TrimSuffix(names[0], "."), nil
+}
+
+func (r *hostnameResolver) lookupAddr(resolver addrResolver, ip net.IP) ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+	return resolver.LookupAddr(ctx, ip.String())
+}
+
+// hostnameCache keeps the names of IPs for a while, so that scans of the same
+// addresses, such as those of -watch, do not look them up every time. It
+// holds at most size IPs, dropping the one closest to expiring to make room.
+// It is safe for concurrent use.
+type hostnameCache struct {
+	ttl  time.Duration
+	size int
+
+	mu      sync.Mutex
+	entries map[string]hostnameEntry
+}
+
+type hostnameEntry struct {
+	name    string
+	expires time.Time
+}
+
+func newHostnameCache(ttl time.Duration, size int) *hostnameCache {
+	return &hostnameCache{ttl: ttl, size: size, entries: make(map[string]hostnameEntry)}
+}
+
+// Get returns the cached name of ip, if it has not expired.
+func (c *hostnameCache) Get(ip net.IP) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[ip.String()]
+	if !ok || time.Now().After(entry.expires) {
+		return "", false
+	}
+	return entry.name, true
+}
+
+// Put caches name as the name of ip.
+func (c *hostnameCache) Put(ip net.IP, name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	key := ip.String()
+	if _, ok := c.entries[key]; !ok && len(c.entries) >= c.size {
+		c.evict(now)
+	}
+	c.entries[key] = hostnameEntry{name: name, expires: now.Add(c.ttl)}
+}
+
+// evict drops the expired names, or the one closest to expiring if none has
+// expired.
+func (c *hostnameCache) evict(now time.Time) {
+	var oldest string
+	for key, entry := range c.entries {
+		if now.After(entry.expires) {
+			delete(c.entries, key)
+		} else if oldest == "" || entry.expires.Before(c.entries[oldest].expires) {
+			oldest = key
+		}
+	}
+	if len(c.entries) >= c.size {
+		delete(c.entries, oldest)
+	}
+}
+
+// Clear forgets every name, so that they are looked up again.
+func (c *hostnameCache) Clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	clear(c.entries)
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"slices"
+	"testing"
+	"time"
+)
+
+// stubResolver answers with the names of addrs, or with err, and records the
+// addresses it was asked for.
+type stubResolver struct {
+	names map[string][]string
+	err   error
+	asked []string
+}
+
+func (r *stubResolver) LookupAddr(ctx context.Context, addr string) ([]string, error) {
+	r.asked = append(r.asked, addr)
+	if r.err != nil {
+		return nil, r.err
+	}
+	names, ok := r.names[addr]
+	if !ok {
+		return nil, &net.DNSError{Err: "no such host", Name: addr, IsNotFound: true}
+	}
+	return names, nil
+}
+
+func TestHostnameResolverOrder(t *testing.T) {
+	system := map[string][]string{"10.0.0.1": {"one.corp.", "alias.corp."}, "10.0.0.2": {"two.corp."}}
+	unreachable := &net.DNSError{Err: "i/o timeout", Name: "10.0.0.53:53", IsTimeout: true}
+	tests := []struct {
+		name       string
+		custom     *stubResolver
+		system     *stubResolver
+		lookups    []string
+		want       []string
+		customAsks []string
+		systemAsks []string
+	}{
+		{
+			name:       "system resolver",
+			system:     &stubResolver{names: system},
+			lookups:    []string{"10.0.0.1", "10.0.0.3"},
+			want:       []string{"one.corp", ""},
+			systemAsks: []string{"10.0.0.1", "10.0.0.3"},
+		},
+		{
+			name:       "answers are cached",
+			system:     &stubResolver{names: system},
+			lookups:    []string{"10.0.0.1", "10.0.0.3", "10.0.0.1", "10.0.0.3"},
+			want:       []string{"one.corp", "", "one.corp", ""},
+			systemAsks: []string{"10.0.0.1", "10.0.0.3"},
+		},
+		{
+			name:       "failures are not cached",
+			system:     &stubResolver{err: errors.New("connection refused")},
+			lookups:    []string{"10.0.0.1", "10.0.0.1"},
+			want:       []string{"", ""},
+			systemAsks: []string{"10.0.0.1", "10.0.0.1"},
+		},
+		{
+			name:       "server before the system resolver",
+			custom:     &stubResolver{names: map[string][]string{"10.0.0.1": {"one.internal."}}},
+			system:     &stubResolver{names: system},
+			lookups:    []string{"10.0.0.1", "10.0.0.2"},
+			want:       []string{"one.internal", ""},
+			customAsks: []string{"10.0.0.1", "10.0.0.2"},
+		},
+		{
+			name:       "unreachable server",
+			custom:     &stubResolver{err: unreachable},
+			system:     &stubResolver{names: system},
+			lookups:    []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"},
+			want:       []string{"one.corp", "two.corp", ""},
+			customAsks: []string{"10.0.0.1"},
+			systemAsks: []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newHostnameResolver("", time.Second)
+			r.server, r.system = "10.0.0.53:53", tt.system
+			if tt.custom != nil {
+				r.custom = tt.custom
+			}
+
+			var names []string
+			for _, ip := range tt.lookups {
+				names = append(names, r.lookup(net.ParseIP(ip)))
+			}
+			if !slices.Equal(names, tt.want) {
+				t.Errorf("names = %q, want %q", names, tt.want)
+			}
+			if tt.custom != nil && !slices.Equal(tt.custom.asked, tt.customAsks) {
+				t.Errorf("server asked for %v, want %v", tt.custom.asked, tt.customAsks)
+			}
+			if !slices.Equal(tt.system.asked, tt.systemAsks) {
+				t.Errorf("system resolver asked for %v, want %v", tt.system.asked, tt.systemAsks)
+			}
+		})
+	}
+}
@@ -0,0 +1,300 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// dashboardBuffer is the number of events a slow browser may fall behind
+// before it is disconnected. It reconnects and starts over from a snapshot.
+const dashboardBuffer = 256
+
+var dashboardTemplate = template.Must(template.New("dashboard").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>IP address analyzer: {{.}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; color: #222; }
+table { border-collapse: collapse; }
+th, td { padding: 4px 12px; border-bottom: 1px solid #ddd; text-align: left; }
+th { background: #f4f4f4; }
+.used { color: #1a7f37; font-weight: bold; }
+.free { color: #cf222e; }
+.conflict { color: #9a6700; font-weight: bold; }
+.unknown { color: #6e7781; }
+</style>
+</head>
+<body>
+<h1>IP address analyzer</h1>
+<p>Analyzed address pool: <strong>{{.}}</strong></p>
+<p><span id="state">scanning</span>: <span id="used">0</span> used, <span id="free">0</span> free, <span id="unknown">0</span> unknown
+(<a href="results.json">JSON</a>)</p>
+<table>
+<thead>
+<tr><th>IP</th><th>Status</th><th>Hostname</th><th>RTT (ms)</th><th>MAC</th><th>Error</th></tr>
+</thead>
+<tbody id="results"></tbody>
+</table>
+<script>
+var counts = { used: 0, free: 0, unknown: 0 };
+var events = new EventSource("events");
+events.addEventListener("result", function (e) {
+  var r = JSON.parse(e.data);
+  var status = r.conflict ? "conflict" : r.status;
+  counts[r.status]++;
+  document.getElementById("used").textContent = counts.used;
+  document.getElementById("free").textContent = counts.free;
+  document.getElementById("unknown").textContent = counts.unknown;
+
+  var row = document.getElementById("results").insertRow();
+  [r.ip, status, r.hostname || "", r.used ? r.rtt_ms.toFixed(2) : "", (r.macs || []).join(", "), r.error || ""]
+    .forEach(function (text, i) {
+      var cell = row.insertCell();
+      cell.textContent = text;
+      if (i === 1) {
+        cell.className = status;
+      }
+    });
+});
+events.addEventListener("done", function (e) {
+  var done = JSON.parse(e.data);
+  document.getElementById("state").textContent = done.error ? "failed: " + done.error : "done";
+  events.close();
+});
+</script>
+</body>
+</html>
+`))
+
+// dashboard serves the results of a scan to browsers while it runs: an HTML
+// page that follows the scan through Server-Sent Events on /events, and the
+// results so far on /results.json.
+type dashboard struct {
+	targets []string
+	display displayOptions
+
+	mu      sync.Mutex
+	meta    ScanMeta
+	results []Result
+	done    *dashboardEvent
+	clients map[chan dashboardEvent]bool
+}
+
+type dashboardEvent struct {
+	name string
+	data []byte
+}
+
+func newDashboard(display displayOptions) *dashboard {
+	return &dashboard{display: display, clients: make(map[chan dashboardEvent]bool)}
+}
+
+// add is the Options.OnResult callback that records result and sends it to
+// every browser.
+func (d *dashboard) add(result Result) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.results = append(d.results, result)
+	if event, ok := d.resultEvent(result); ok {
+		d.broadcast(event)
+	}
+}
+
+// finish tells every browser that the scan is over.
+func (d *dashboard) finish(meta ScanMeta, err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	done := struct {
+		Summary Summary `json:"summary"`
+		Error   string  `json:"error,omitempty"`
+	}{Summary: Summarize(d.results)}
+	if err != nil {
+		done.Error = err.Error()
+	}
+	data, _ := json.Marshal(done)
+
+	d.meta = meta
+	d.done = &dashboardEvent{name: "done", data: data}
+	d.broadcast(*d.done)
+	for client := range d.clients {
+		close(client)
+		delete(d.clients, client)
+	}
+}
+
+func (d *dashboard) resultEvent(result Result) (dashboardEvent, bool) {
+	if d.display.onlyUsed && !result.Used {
+		return dashboardEvent{}, false
+	}
+	data, err := json.Marshal(toJSONResult(result))
+	if err != nil {
+		logger.Error("encoding result failed", "ip", result.IP, "err", err)
+		return dashboardEvent{}, false
+	}
+	return dashboardEvent{name: "result", data: data}, true
+}
+
+// broadcast sends event to every browser, dropping those that fall behind.
+// d.mu must be held.
+func (d *dashboard) broadcast(event dashboardEvent) {
+	for client := range d.clients {
+		select {
+		case client <- event:
+		default:
+			close(client)
+			delete(d.clients, client)
+		}
+	}
+}
+
+// subscribe returns the events so far and, unless the scan is over, a channel
+// for the ones to come.
+func (d *dashboard) subscribe() ([]dashboardEvent, chan dashboardEvent) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var snapshot []dashboardEvent
+	for _, result := range d.results {
+		if event, ok := d.resultEvent(result); ok {
+			snapshot = append(snapshot, event)
+		}
+	}
+	if d.done != nil {
+		return append(snapshot, *d.done), nil
+	}
+
+	client := make(chan dashboardEvent, dashboardBuffer)
+	d.clients[client] = true
+	return snapshot, client
+}
+
+func (d *dashboard) unsubscribe(client chan dashboardEvent) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.clients[client] {
+		close(client)
+		delete(d.clients, client)
+	}
+}
+
+func (d *dashboard) handler() http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/{$}", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := dashboardTemplate.Execute(w, strings.Join(d.targets, ", ")); err != nil {
+			logger.Error("writing dashboard failed", "err", err)
+		}
+	})
+
+	mux.HandleFunc("/results.json", func(w http.ResponseWriter, r *http.Request) {
+		d.mu.Lock()
+		meta, results := d.meta, append([]Result(nil), d.results...)
+		d.mu.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := writeJSON(w, d.targets, meta, results, d.display); err != nil {
+			logger.Error("writing results failed", "err", err)
+		}
+	})
+
+	mux.HandleFunc("/events", func(w http.ResponseWriter, r *http.Request) {
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+
+		snapshot, client := d.subscribe()
+		for _, event := range snapshot {
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.name, event.data)
+		}
+		flusher.Flush()
+		if client == nil {
+			return
+		}
+		defer d.unsubscribe(client)
+
+		for {
+			select {
+			case event, ok := <-client:
+				if !ok {
+					return
+				}
+				fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.name, event.data)
+				flusher.Flush()
+			case <-r.Context().Done():
+				return
+			}
+		}
+	})
+
+	return mux
+}
+
+// runServe scans targets while d serves the results on addr, and keeps
+// serving them after the scan until the process is interrupted.
+func runServe(addr string, analyzer *Analyzer, targets []string, d *dashboard) ([]Result, error) {
+	d.targets = targets
+	d.meta = ScanMeta{Started: time.Now(), CIDR: strings.Join(targets, ", ")}
+
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to listen on %s: %w", addr, err)
+	}
+	server := &http.Server{Handler: d.handler()}
+	go func() {
+		if err := server.Serve(ln); err != nil && err != http.ErrServerClosed {
+			logger.Error("serving dashboard failed", "err", err)
+		}
+	}()
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(ctx)
+	}()
+
+	// Ctrl-C during the scan stops it, and the results so far are printed
+	// as the TUI does.
+	fmt.Fprintf(os.Stderr, "Serving the scan on http://%s/\n", ln.Addr())
+	interrupt := stopOnInterrupt(analyzer, displayOptions{quiet: true})
+	results, meta, err := analyzer.Scan(targets)
+	interrupt()
+	d.finish(meta, err)
+	if err != nil {
+		return nil, err
+	}
+	if analyzer.Stopped() {
+		fmt.Printf("%s in %s%s\n", summaryLine(Summarize(results)), meta.CIDR, deadlineNote(meta))
+		return results, writeCompact(os.Stdout, results, displayOptions{})
+	}
+
+	waitForInterrupt(fmt.Sprintf("Scan finished: %s. Press Ctrl-C to stop serving.", summaryLine(Summarize(results))))
+	return results, nil
+}
+
+// waitForInterrupt prints note to stderr and blocks until the process is
+// interrupted.
+func waitForInterrupt(note string) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	fmt.Fprintln(os.Stderr, note)
+	<-ctx.Done()
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"math/rand"
+	"net"
+	"time"
+)
+
+const (
+	snmpPort    = 161
+	snmpTimeout = time.Second
+
+	// defaultSNMPCommunity is what -udp 161 asks with when -snmp-community
+	// is not set.
+	defaultSNMPCommunity = "public"
+)
+
+// OIDs of sysDescr.0, sysUpTime.0 and sysName.0, BER encoded.
+var (
+	oidSysDescr  = []byte{0x2b, 0x06, 0x01, 0x02, 0x01, 0x01, 0x01, 0x00}
+	oidSysUpTime = []byte{0x2b, 0x06, 0x01, 0x02, 0x01, 0x01, 0x03, 0x00}
+	oidSysName   = []byte{0x2b, 0x06, 0x01, 0x02, 0x01, 0x01, 0x05, 0x00}
+)
+
+// SNMPInfo is what a device told about itself over SNMP.
+type SNMPInfo struct {
+	Name  string
+	Descr string
+}
+
+// lookupSNMP asks ip for its sysName and sysDescr with an SNMPv2c get-request.
+// Devices that do not answer within a second, or reject the community, give
+// an empty SNMPInfo.
+func lookupSNMP(ip net.IP, community string) SNMPInfo {
+	conn, err := net.DialUDP("udp", nil, &net.UDPAddr{IP: ip, Port: snmpPort})
+	if err != nil {
+		logger.Debug("snmp lookup failed", "ip", ip, "err", err)
+		return SNMPInfo{}
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(snmpTimeout))
+
+	id := rand.Int31()
+	if _, err := conn.Write(snmpGetRequest(community, id, oidSysName, oidSysDescr)); err != nil {
+		logger.Debug("snmp lookup failed", "ip", ip, "err", err)
+		return SNMPInfo{}
+	}
+
+	buf := make([]byte, 65535)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			logger.Debug("snmp lookup failed", "ip", ip, "err", err)
+			return SNMPInfo{}
+		}
+		values, err := parseSNMPResponse(buf[:n], id)
+		if err != nil {
+			logger.Debug("invalid snmp response", "ip", ip, "err", err)
+			continue
+		}
+		return SNMPInfo{
+			Name:  printable(string(values[string(oidSysName)])),
+			Descr: printable(string(values[string(oidSysDescr)])),
+		}
+	}
+}
+
+// snmpGetRequest builds an SNMPv2c get-request for oids.
+func snmpGetRequest(community string, id int32, oids ...[]byte) []byte {
+	var bindings []byte
+	for _, oid := range oids {
+		bindings = append(bindings, berTLV(0x30, append(berTLV(0x06, oid), 0x05, 0x00))...)
+	}
+	pdu := berInt(int64(id))
+	pdu = append(pdu, berInt(0)...) // error-status
+	pdu = append(pdu, berInt(0)...) // error-index
+	pdu = append(pdu, berTLV(0x30, bindings)...)
+
+	message := berInt(1) // version 2c
+	message = append(message, berTLV(0x04, []byte(community))...)
+	message = append(message, berTLV(0xa0, pdu)...)
+	return berTLV(0x30, message)
+}
+
+// parseSNMPResponse returns the string values of a get-response to the
+// request with the given ID, keyed by the encoded OID.
+func parseSNMPResponse(data []byte, id int32) (map[string][]byte, error) {
+	_, message, _, err := berRead(data)
+	if err != nil {
+		return nil, err
+	}
+	// Skip the version and the community.
+	for i := 0; i < 2; i++ {
+		if _, _, message, err = berRead(message); err != nil {
+			return nil, err
+		}
+	}
+	tag, pdu, _, err := berRead(message)
+	if err != nil {
+		return nil, err
+	}
+	if tag != 0xa2 {
+		return nil, errors.New("not a get-response")
+	}
+
+	var header [3][]byte
+	for i := range header {
+		if _, header[i], pdu, err = berRead(pdu); err != nil {
+			return nil, err
+		}
+	}
+	if !bytes.Equal(header[0], berInt(int64(id))[2:]) {
+		return nil, errors.New("unexpected request ID")
+	}
+	if !bytes.Equal(header[1], []byte{0}) {
+		return nil, errors.New("error status set")
+	}
+
+	_, bindings, _, err := berRead(pdu)
+	if err != nil {
+		return nil, err
+	}
+	values := make(map[string][]byte)
+	for len(bindings) > 0 {
+		var binding, oid, value []byte
+		var tag byte
+		if _, binding, bindings, err = berRead(bindings); err != nil {
+			return nil, err
+		}
+		if _, oid, binding, err = berRead(binding); err != nil {
+			return nil, err
+		}
+		if tag, value, _, err = berRead(binding); err != nil {
+			return nil, err
+		}
+		if tag == 0x04 {
+			values[string(oid)] = value
+		}
+	}
+	return values, nil
+}
+
+func berTLV(tag byte, value []byte) []byte {
+	out := []byte{tag}
+	switch n := len(value); {
+	case n < 0x80:
+		out = append(out, byte(n))
+	case n <= 0xff:
+		out = append(out, 0x81, byte(n))
+	default:
+		out = append(out, 0x82, byte(n>>8), byte(n))
+	}
+	return append(out, value...)
+}
+
+func berInt(v int64) []byte {
+	var value []byte
+	for {
+		value = append([]byte{byte(v)}, value...)
+		v >>= 8
+		if (v == 0 && value[0]&0x80 == 0) || (v == -1 && value[0]&0x80 != 0) {
+			break
+		}
+	}
+	return berTLV(0x02, value)
+}
+
+// berRead splits the first element off data.
+func berRead(data []byte) (tag byte, value, rest []byte, err error) {
+	if len(data) < 2 {
+		return 0, nil, nil, errors.New("truncated element")
+	}
+	tag, length, data := data[0], int(data[1]), data[2:]
+	if length&0x80 != 0 {
+		octets := length & 0x7f
+		if octets == 0 || octets > 2 || len(data) < octets {
+			return 0, nil, nil, errors.New("invalid length")
+		}
+		length = 0
+		for _, b := range data[:octets] {
+			length = length<<8 | int(b)
+		}
+		data = data[octets:]
+	}
+	if len(data) < length {
+		return 0, nil, nil, errors.New("truncated element")
+	}
+	return tag, data[:length], data[length:], nil
+}
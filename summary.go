@@ -0,0 +1,51 @@
+package main
+
+type Summary struct {
+	Total     int `json:"total"`
+	Used      int `json:"used"`
+	Free      int `json:"free"`
+	Conflicts int `json:"conflicts"`
+
+	// Unknown counts the addresses that are neither known to be used nor
+	// known to be free, because their probe failed or never ran.
+	Unknown int `json:"unknown"`
+
+	// ErrorClasses counts the unknown addresses by the class of their
+	// error, see Result.ErrorClass.
+	ErrorClasses map[string]int `json:"error_classes,omitempty"`
+
+	// Mismatches counts the addresses that answered on some of the
+	// interfaces but not on others.
+	Mismatches int `json:"mismatches,omitempty"`
+
+	// Woke counts the addresses that only answered after the warm-up.
+	Woke int `json:"woke,omitempty"`
+}
+
+func Summarize(results []Result) Summary {
+	summary := Summary{Total: len(results)}
+	for _, result := range results {
+		switch result.Status() {
+		case StatusUsed:
+			summary.Used++
+		case StatusFree:
+			summary.Free++
+		case StatusUnknown:
+			summary.Unknown++
+			if summary.ErrorClasses == nil {
+				summary.ErrorClasses = make(map[string]int)
+			}
+			summary.ErrorClasses[result.ErrorClass()]++
+		}
+		if result.Conflict() {
+			summary.Conflicts++
+		}
+		if result.Mismatch() {
+			summary.Mismatches++
+		}
+		if result.Woke {
+			summary.Woke++
+		}
+	}
+	return summary
+}
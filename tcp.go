@@ -0,0 +1,261 @@
+package main
+
+import (
+	"bufio"
+	"cmp"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"maps"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+	"unicode"
+
+	"github.com/go-ping/ping"
+)
+
+const (
+	bannerTimeout  = time.Second
+	maxBannerWidth = 120
+)
+
+// httpPorts get a HEAD request for a banner, because web servers do not talk
+// first. The ones that are true speak TLS.
+var httpPorts = map[int]bool{80: false, 443: true, 8000: false, 8080: false, 8443: true}
+
+// Service is a TCP port that accepted a connection.
+type Service struct {
+	Port int
+
+	// Banner is the first line the service sent, or the status line and
+	// server of a web server. It is only set with Options.Banner.
+	Banner string
+}
+
+// States of a TCP port in Result.Ports.
+const (
+	portOpen     = "open"
+	portClosed   = "closed"
+	portFiltered = "filtered"
+)
+
+// tcpPinger marks a host as used when it accepts or refuses a connection on
+// any of the ports: both prove something is there. With Options.RequireAll
+// every port has to accept instead. Only accepting ports are reported as
+// services.
+type tcpPinger struct {
+	opts Options
+
+	mu       sync.Mutex
+	services map[string][]Service
+	ports    map[string]map[int]string
+}
+
+func newTCPPinger(opts Options) *tcpPinger {
+	return &tcpPinger{opts: opts, services: make(map[string][]Service), ports: make(map[string]map[int]string)}
+}
+
+func (p *tcpPinger) Ping(ctx context.Context, address net.IP, onRecv func(*ping.Packet)) (*ping.Statistics, error) {
+	ipAddr := &net.IPAddr{IP: address}
+	stats := &ping.Statistics{IPAddr: ipAddr, Addr: address.String()}
+
+	var (
+		mu       sync.Mutex
+		wg       sync.WaitGroup
+		services []Service
+		ports    = make(map[int]string)
+		// unreachable is the error of a port that failed because there is
+		// no route to the host, as ICMP reports it.
+		unreachable error
+	)
+	for _, port := range p.opts.TCPPorts {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			service, rtt, err := p.connect(ctx, address, port)
+
+			mu.Lock()
+			defer mu.Unlock()
+			stats.PacketsSent++
+			if errors.Is(err, syscall.ENETUNREACH) || errors.Is(err, syscall.EHOSTUNREACH) {
+				unreachable = cmp.Or(unreachable, err)
+			}
+			answered := err == nil || errors.Is(err, syscall.ECONNREFUSED)
+			switch {
+			case service != nil:
+				ports[port] = portOpen
+			case answered:
+				ports[port] = portClosed
+			default:
+				ports[port] = portFiltered
+			}
+			if !answered {
+				return
+			}
+			stats.PacketsRecv++
+			stats.Rtts = append(stats.Rtts, rtt)
+			if service != nil {
+				services = append(services, *service)
+			}
+			if onRecv != nil {
+				onRecv(&ping.Packet{Rtt: rtt, IPAddr: ipAddr, Addr: address.String(), Seq: port})
+			}
+		}()
+	}
+	wg.Wait()
+
+	if stats.PacketsRecv == 0 && unreachable != nil {
+		// Without a route no port could answer, so the host is not known to
+		// be free.
+		summarizeStats(stats)
+		return stats, unreachable
+	}
+	if p.opts.RequireAll && len(services) < len(p.opts.TCPPorts) {
+		// Some of the required services are missing: the host does not
+		// count, whatever answered.
+		stats.PacketsRecv, stats.Rtts = 0, nil
+	}
+	summarizeStats(stats)
+
+	p.mu.Lock()
+	if len(services) > 0 {
+		p.services[address.String()] = services
+	}
+	p.ports[address.String()] = ports
+	p.mu.Unlock()
+
+	logger.Debug("tcp probe finished",
+		"ip", address,
+		"ports", len(p.opts.TCPPorts),
+		"answered", stats.PacketsRecv,
+		"open", len(services))
+
+	return stats, nil
+}
+
+// bytesSent counts a SYN without payload for every port. Connections that
+// are accepted send a few more packets to find the service and close, which
+// are left out.
+func (p *tcpPinger) bytesSent(ip net.IP, stats *ping.Statistics) int {
+	// The TCP header of a SYN as Linux sends it, with the MSS, SACK,
+	// timestamp and window scale options.
+	const synHeader = 40
+	return stats.PacketsSent * (ipHeaderLen(ip) + synHeader)
+}
+
+// addDetails sets the open ports found by the last probe of the host, sorted
+// by port, and the state of every port.
+func (p *tcpPinger) addDetails(result *Result) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	services := p.services[result.IP.String()]
+	delete(p.services, result.IP.String())
+	slices.SortFunc(services, func(a, b Service) int { return cmp.Compare(a.Port, b.Port) })
+	result.Services = services
+	result.Ports = p.ports[result.IP.String()]
+	delete(p.ports, result.IP.String())
+}
+
+// portMap lists the state of every port of result in port order, e.g.
+// "22 closed, 443 open", or returns an empty string without TCP probes.
+func portMap(result Result) string {
+	ports := slices.Sorted(maps.Keys(result.Ports))
+	states := make([]string, len(ports))
+	for i, port := range ports {
+		states[i] = fmt.Sprintf("%d %s", port, result.Ports[port])
+	}
+	return strings.Join(states, ", ")
+}
+
+// connect dials port on address. service is nil and err is set if the port
+// did not accept the connection: ECONNREFUSED if the port is closed, which
+// still proves the host is there.
+func (p *tcpPinger) connect(ctx context.Context, address net.IP, port int) (service *Service, rtt time.Duration, err error) {
+	var dialer net.Dialer
+	sent := time.Now()
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(address.String(), strconv.Itoa(port)))
+	rtt = time.Since(sent)
+	if err != nil {
+		return nil, rtt, err
+	}
+	defer conn.Close()
+
+	service = &Service{Port: port}
+	if p.opts.Banner {
+		banner, err := grabBanner(conn, address, port)
+		if err != nil {
+			logger.Debug("banner grab failed", "ip", address, "port", port, "err", err)
+		}
+		service.Banner = banner
+	}
+	return service, rtt, nil
+}
+
+// grabBanner reads what the service on conn says first. Web servers are sent
+// a HEAD request instead, since they wait for the client. It gives up after
+// bannerTimeout.
+func grabBanner(conn net.Conn, address net.IP, port int) (string, error) {
+	conn.SetDeadline(time.Now().Add(bannerTimeout))
+
+	secure, web := httpPorts[port]
+	if secure {
+		tlsConn := tls.Client(conn, &tls.Config{InsecureSkipVerify: true, ServerName: address.String()})
+		if err := tlsConn.Handshake(); err != nil {
+			return "", err
+		}
+		conn = tlsConn
+	}
+	if web {
+		if _, err := fmt.Fprintf(conn, "HEAD / HTTP/1.0\r\nHost: %s\r\n\r\n", address); err != nil {
+			return "", err
+		}
+	}
+
+	reader := bufio.NewReader(conn)
+	first, err := reader.ReadString('\n')
+	banner := printable(first)
+	if !web || banner == "" {
+		return banner, err
+	}
+	for {
+		line, err := reader.ReadString('\n')
+		name, value, ok := strings.Cut(line, ":")
+		if ok && strings.EqualFold(name, "server") {
+			return truncate(banner+", "+printable(value), maxBannerWidth), nil
+		}
+		if err != nil || strings.TrimSpace(line) == "" {
+			return banner, nil
+		}
+	}
+}
+
+// printable trims s and drops control characters, so a banner is safe to
+// show in a terminal.
+func printable(s string) string {
+	s = strings.Map(func(r rune) rune {
+		if unicode.IsPrint(r) {
+			return r
+		}
+		return -1
+	}, strings.TrimSpace(s))
+	return truncate(s, maxBannerWidth)
+}
+
+// parsePorts parses a comma separated list of TCP ports.
+func parsePorts(s string) ([]int, error) {
+	var ports []int
+	for _, field := range strings.Split(s, ",") {
+		port, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil || port < 1 || port > 65535 {
+			return nil, fmt.Errorf("Invalid TCP port %q", field)
+		}
+		ports = append(ports, port)
+	}
+	return ports, nil
+}
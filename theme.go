@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+// Theme holds the tview colors of the TUI. An empty color leaves the text in
+// the default color.
+type Theme struct {
+	Used     string
+	Free     string
+	Conflict string
+	Unknown  string // hosts whose probe failed
+	Warning  string
+
+	// Symbols marks the status of hosts with a symbol as well, so it does
+	// not depend on telling colors apart.
+	Symbols bool
+
+	// Markers marks the status of hosts with a letter in brackets instead,
+	// such as [U] for used, for terminals without colors that may lack the
+	// symbols as well.
+	Markers bool
+}
+
+var defaultTheme = Theme{
+	Used:     "green",
+	Free:     "red",
+	Conflict: "yellow",
+	Unknown:  "gray",
+	Warning:  "yellow",
+}
+
+// noColorTheme prints everything in the default color.
+var noColorTheme = Theme{}
+
+// markerTheme is the theme of terminals that cannot show colors.
+var markerTheme = Theme{Markers: true}
+
+// themes are the named themes for -theme.
+var themes = map[string]Theme{
+	"default": defaultTheme,
+	// colorblind avoids telling red from green, the most common color
+	// vision deficiency.
+	"colorblind": {Used: "blue", Free: "orange", Conflict: "fuchsia", Unknown: "gray", Warning: "fuchsia", Symbols: true},
+	"mono":       {Symbols: true},
+}
+
+// statusSymbols prefix the status of hosts with Theme.Symbols.
+var statusSymbols = map[string]string{"used": "✓", "free": "✗", "conflict": "‼", "unknown": "?"}
+
+// statusMarkers prefix the status of hosts with Theme.Markers. The opening
+// brackets are escaped so that tview does not take them for color tags.
+var statusMarkers = map[string]string{"used": "[U[]", "free": "[F[]", "conflict": "[C[]", "unknown": "[?[]"}
+
+// terminalHasColor reports whether the terminfo entry of TERM has colors.
+// Terminals without an entry, such as dumb, count as without colors.
+func terminalHasColor() bool {
+	ti, err := tcell.LookupTerminfo(os.Getenv("TERM"))
+	return err == nil && ti.Colors >= 8
+}
+
+// Paint wraps text in the tags of color, or returns it as is without a color.
+func (t Theme) Paint(color, text string) string {
+	if color == "" {
+		return text
+	}
+	return "[" + color + "]" + text + "[-]"
+}
+
+// StatusColor returns the color of the status of result.
+func (t Theme) StatusColor(result Result) string {
+	switch {
+	case result.Conflict(), result.Mismatch():
+		return t.Conflict
+	case result.Status() == StatusUsed:
+		return t.Used
+	case result.Status() == StatusUnknown:
+		return t.Unknown
+	default:
+		return t.Free
+	}
+}
+
+// Status returns the status of result, with a symbol or marker in front if
+// the theme uses them.
+func (t Theme) Status(result Result) string {
+	status := statusText(result)
+	switch {
+	case t.Markers:
+		return statusMarkers[status] + " " + status
+	case t.Symbols:
+		return statusSymbols[status] + " " + status
+	default:
+		return status
+	}
+}
+
+// parseTheme overrides the colors of base with a comma separated list of
+// name=color pairs, for example "used=blue,free=magenta".
+func parseTheme(spec string, base Theme) (Theme, error) {
+	theme := base
+	for _, pair := range strings.Split(spec, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		name, color, ok := strings.Cut(pair, "=")
+		name, color = strings.TrimSpace(name), strings.TrimSpace(color)
+		if !ok {
+			return base, fmt.Errorf("Invalid color %q: must be name=color", pair)
+		}
+		if _, known := tcell.ColorNames[color]; !known && !strings.HasPrefix(color, "#") {
+			return base, fmt.Errorf("Unknown color %q", color)
+		}
+
+		switch name {
+		case "used":
+			theme.Used = color
+		case "free":
+			theme.Free = color
+		case "conflict":
+			theme.Conflict = color
+		case "unknown":
+			theme.Unknown = color
+		case "warning":
+			theme.Warning = color
+		default:
+			return base, fmt.Errorf("Unknown color name %q: must be used, free, conflict, unknown or warning", name)
+		}
+	}
+	return theme, nil
+}
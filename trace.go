@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"os"
+	"time"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+const (
+	traceMaxHops    = 30
+	traceHopTimeout = 2 * time.Second
+)
+
+// Hop is a router on the way to a traced address, or the address itself. IP is
+// nil if nothing answered within the timeout.
+type Hop struct {
+	TTL     int
+	IP      net.IP
+	RTT     time.Duration
+	Reached bool
+}
+
+// Tracer finds the routers on the way to an address. onHop is called for every
+// hop as soon as it is known, in order.
+type Tracer interface {
+	Trace(ctx context.Context, ip net.IP, onHop func(Hop)) error
+}
+
+// icmpTracer sends echo requests with an increasing TTL and collects the time
+// exceeded messages of the routers. It needs a raw socket, so it only works
+// with root or CAP_NET_RAW.
+type icmpTracer struct {
+	timeout time.Duration
+}
+
+func newICMPTracer(opts Options) *icmpTracer {
+	return &icmpTracer{timeout: min(opts.Timeout, traceHopTimeout)}
+}
+
+func (t *icmpTracer) Trace(ctx context.Context, address net.IP, onHop func(Hop)) error {
+	v4 := address.To4() != nil
+	network, proto := "ip6:ipv6-icmp", 58
+	var echoType, replyType, exceededType icmp.Type = ipv6.ICMPTypeEchoRequest, ipv6.ICMPTypeEchoReply, ipv6.ICMPTypeTimeExceeded
+	if v4 {
+		network, proto = "ip4:icmp", 1
+		echoType, replyType, exceededType = ipv4.ICMPTypeEcho, ipv4.ICMPTypeEchoReply, ipv4.ICMPTypeTimeExceeded
+	}
+
+	conn, err := icmp.ListenPacket(network, "")
+	if err != nil {
+		return &setupError{fmt.Errorf("Traceroute needs root or CAP_NET_RAW: %w", err)}
+	}
+	defer conn.Close()
+
+	stop := context.AfterFunc(ctx, func() { conn.SetDeadline(time.Now()) })
+	defer stop()
+
+	id := os.Getpid() & 0xffff
+	buf := make([]byte, 1500)
+	for ttl := 1; ttl <= traceMaxHops && ctx.Err() == nil; ttl++ {
+		if v4 {
+			err = conn.IPv4PacketConn().SetTTL(ttl)
+		} else {
+			err = conn.IPv6PacketConn().SetHopLimit(ttl)
+		}
+		if err != nil {
+			return err
+		}
+
+		request := icmp.Message{Type: echoType, Body: &icmp.Echo{ID: id, Seq: ttl, Data: []byte("ipdefiner")}}
+		data, err := request.Marshal(nil)
+		if err != nil {
+			return err
+		}
+
+		sent := time.Now()
+		if _, err := conn.WriteTo(data, &net.IPAddr{IP: address}); err != nil {
+			return err
+		}
+		conn.SetReadDeadline(sent.Add(t.timeout))
+
+		hop := Hop{TTL: ttl}
+		for hop.IP == nil {
+			n, peer, err := conn.ReadFrom(buf)
+			if err != nil {
+				break
+			}
+			reply, err := icmp.ParseMessage(proto, buf[:n])
+			if err != nil {
+				continue
+			}
+
+			switch reply.Type {
+			case replyType:
+				echo, ok := reply.Body.(*icmp.Echo)
+				if !ok || echo.ID != id || echo.Seq != ttl {
+					continue
+				}
+				hop.Reached = true
+			case exceededType:
+				exceeded, ok := reply.Body.(*icmp.TimeExceeded)
+				if !ok || !quotesEcho(exceeded.Data, v4, id, ttl) {
+					continue
+				}
+			default:
+				continue
+			}
+			hop.IP = peer.(*net.IPAddr).IP
+			hop.RTT = time.Since(sent)
+		}
+
+		if ctx.Err() != nil {
+			break
+		}
+		onHop(hop)
+		if hop.Reached {
+			break
+		}
+	}
+	return ctx.Err()
+}
+
+// quotesEcho reports whether data, the start of the packet quoted by an ICMP
+// error, is one of our echo requests.
+func quotesEcho(data []byte, v4 bool, id, seq int) bool {
+	headerLen := ipv6.HeaderLen
+	if v4 {
+		if len(data) == 0 {
+			return false
+		}
+		headerLen = int(data[0]&0x0f) * 4
+	}
+	if len(data) < headerLen+8 {
+		return false
+	}
+	echo := data[headerLen:]
+	return int(binary.BigEndian.Uint16(echo[4:])) == id && int(binary.BigEndian.Uint16(echo[6:])) == seq
+}
@@ -0,0 +1,875 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+	"github.com/samber/lo"
+)
+
+const (
+	tuiTitle = "IP address analyzer"
+
+	// The detail pane pings the selected host detailPings times, one ping
+	// every detailInterval.
+	detailPings    = 5
+	detailInterval = time.Second
+	detailWidth    = 36
+
+	hostDetailsWidth = 64
+)
+
+// chooseLocalSubnet lets the user pick one of subnets. It returns an empty
+// string if the user quits instead.
+func chooseLocalSubnet(subnets []localSubnet) (string, error) {
+	app := tview.NewApplication()
+
+	var chosen string
+	list := tview.NewList().ShowSecondaryText(false)
+	list.SetBorder(true).SetTitle(" Choose the subnet to analyze ")
+	for i, subnet := range subnets {
+		shortcut := rune(0)
+		if i < 9 {
+			shortcut = rune('1' + i)
+		}
+		list.AddItem(fmt.Sprintf("%s (%s)", subnet.CIDR, subnet.Interface), "", shortcut, func() {
+			chosen = subnet.CIDR
+			app.Stop()
+		})
+	}
+	list.SetDoneFunc(app.Stop)
+
+	if err := app.SetRoot(list, true).SetFocus(list).Run(); err != nil {
+		return "", err
+	}
+	return chosen, nil
+}
+
+func runTUI(analyzer *Analyzer, targets []string, display displayOptions, onChange func(statusChange)) ([]Result, error) {
+	app := tview.NewApplication()
+
+	if len(targets) == 0 {
+		text, err := askTargets(app, display.theme, display.history)
+		if err != nil {
+			return nil, err
+		}
+		targets = parseTargets(text)
+	}
+
+	textView := tview.NewTextView().
+		SetDynamicColors(true).
+		SetChangedFunc(func() {
+			app.Draw()
+		})
+
+	var (
+		scanResults []Result
+		scanMeta    ScanMeta
+		scanErr     error
+		refresh     = make(chan struct{}, 1)
+		scanning    atomic.Bool
+	)
+
+	// shownHeader and shownNotes are what the results view shows, once
+	// there is one.
+	var (
+		showResults             func(header, notes string)
+		shownHeader, shownNotes string
+	)
+
+	// Space or p pauses a scan and resumes it. While -every scans in the
+	// background the results view tells that the scan is paused, since the
+	// progress is not on screen.
+	togglePause := func() {
+		if analyzer.Paused() {
+			analyzer.Resume()
+		} else {
+			analyzer.Pause()
+		}
+		select {
+		case refresh <- struct{}{}:
+		default:
+		}
+		if showResults != nil {
+			header := shownHeader
+			if analyzer.Paused() {
+				header += "\n" + display.theme.Paint(display.theme.Warning, "Scan in the background paused (press Space to resume)")
+			}
+			showResults(header, shownNotes)
+		}
+	}
+
+	// Escape or Ctrl-C during a scan stops it. The TUI closes and the
+	// results so far are printed. While -every scans in the background,
+	// Escape in a popup only closes the popup, and Space or p in the note
+	// field are typed as usual.
+	app.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		if !scanning.Load() {
+			return event
+		}
+		// The popups are the only text views and input fields besides the
+		// progress.
+		focus := app.GetFocus()
+		_, typing := focus.(*tview.InputField)
+		inPopup := typing
+		if view, ok := focus.(*tview.TextView); ok && view != textView {
+			inPopup = true
+		}
+		switch {
+		case event.Key() == tcell.KeyCtrlC || (event.Key() == tcell.KeyEscape && !inPopup):
+			analyzer.Stop()
+			return nil
+		case (event.Rune() == 'p' || event.Rune() == ' ') && !typing:
+			togglePause()
+			return nil
+		}
+		return event
+	})
+
+	// scan shows the results of a scan once it is done, marking what changed
+	// since previous, and returns them. With -every the results stay on
+	// screen while the next scan runs in the background, and then replace
+	// those in the view.
+	scan := func(previous []Result) ([]Result, error) {
+		scanning.Store(true)
+		done := make(chan struct{})
+		stopped := make(chan struct{})
+
+		go func() {
+			defer close(stopped)
+			ticker := time.NewTicker(500 * time.Millisecond)
+			defer ticker.Stop()
+
+			count := 0
+			msg := "loading"
+			for {
+				textView.Clear()
+				probed, total := analyzer.Progress()
+				if analyzer.Paused() {
+					fmt.Fprintf(textView, "%s %d/%d (press Space to resume)", display.theme.Paint(display.theme.Warning, "paused"), probed, total)
+				} else {
+					fmt.Fprintf(textView, "%s %d/%d", msg, probed, total)
+				}
+				select {
+				case <-done:
+					return
+				case <-refresh:
+					continue
+				case <-ticker.C:
+				}
+				msg += "."
+				count++
+				if count == 4 {
+					msg = "loading"
+					count = 0
+				}
+			}
+		}()
+
+		results, meta, err := analyzer.Scan(targets)
+		scanning.Store(false)
+		close(done)
+		<-stopped
+		if err != nil {
+			logger.Error("scan failed", "targets", targets, "err", err)
+			scanErr = err
+			app.Stop()
+			return nil, err
+		}
+		if meta.Interrupted {
+			scanResults, scanMeta = results, meta
+			app.Stop()
+			return results, nil
+		}
+
+		markChanges(previous, results)
+
+		var header, notes bytes.Buffer
+		fmt.Fprintf(&header, "Analyzed address pool: %s\n", meta.CIDR)
+		for _, block := range canonicalBlocks(targets) {
+			if info, err := subnetInfo(block); err == nil {
+				writeSubnetInfo(&header, info)
+			}
+		}
+		fmt.Fprintf(&header, "Scanned %d addresses", meta.HostCount)
+		if meta.Excluded > 0 {
+			fmt.Fprintf(&header, " (%d excluded)", meta.Excluded)
+		}
+		fmt.Fprintf(&header, " at %s%s in %s", meta.Started.Format(time.DateTime), trafficNote(meta), meta.Duration.Round(time.Millisecond))
+		if note := deadlineNote(meta); note != "" {
+			fmt.Fprint(&header, display.theme.Paint(display.theme.Warning, note))
+		}
+		if display.grouped(targets) {
+			fmt.Fprintf(&header, "\nAll pools: %s", summaryLine(Summarize(results)))
+		}
+		if conflicts := Summarize(results).Conflicts; conflicts > 0 {
+			warning := fmt.Sprintf("Conflicts: %d IPs answer from more than one MAC address", conflicts)
+			fmt.Fprintf(&header, "\n%s", display.theme.Paint(display.theme.Conflict, warning))
+		}
+		if mismatches := Summarize(results).Mismatches; mismatches > 0 {
+			fmt.Fprintf(&header, "\n%s", display.theme.Paint(display.theme.Conflict, mismatchWarning(mismatches)))
+		}
+		for _, block := range proxyARPBlocks(targets, results) {
+			fmt.Fprintf(&header, "\n%s", display.theme.Paint(display.theme.Warning, proxyARPWarning(block)))
+		}
+		if display.every > 0 {
+			fmt.Fprintf(&header, "\nScanning again every %s, next at %s", display.every, time.Now().Add(display.every).Format(time.TimeOnly))
+			if changed := lo.CountBy(results, func(r Result) bool { return r.Changed }); changed > 0 {
+				fmt.Fprintf(&header, "\n%s", display.theme.Paint(display.theme.Warning, fmt.Sprintf("Changed since the scan before: %d IPs", changed)))
+			}
+		}
+
+		if display.hist {
+			fmt.Fprintf(&notes, "Round-trip times of used IPs:\n\n")
+			writeHistogramBars(&notes, Histogram(results))
+		}
+
+		if display.expected != nil {
+			var alerts bytes.Buffer
+			writeExpectedAlerts(&alerts, results, display.expected, "")
+			if alerts.Len() > 0 {
+				if notes.Len() > 0 {
+					fmt.Fprintln(&notes)
+				}
+				text := strings.TrimPrefix(strings.TrimSuffix(alerts.String(), "\n"), "\n")
+				fmt.Fprint(&notes, display.theme.Paint(display.theme.Warning, text))
+			}
+		}
+
+		var woke bytes.Buffer
+		writeWokeHosts(&woke, results)
+		if woke.Len() > 0 {
+			if notes.Len() > 0 {
+				fmt.Fprintln(&notes)
+			}
+			fmt.Fprint(&notes, strings.TrimSuffix(woke.String(), "\n"))
+		}
+
+		var classes bytes.Buffer
+		writeErrorClasses(&classes, Summarize(results))
+		if classes.Len() > 0 {
+			if notes.Len() > 0 {
+				fmt.Fprintln(&notes)
+			}
+			fmt.Fprint(&notes, strings.TrimSuffix(classes.String(), "\n"))
+		}
+
+		if display.html != "" {
+			if notes.Len() > 0 {
+				fmt.Fprintln(&notes)
+			}
+			if err := writeHTMLFile(display.html, meta, results, display); err != nil {
+				logger.Error("writing report failed", "file", display.html, "err", err)
+				fmt.Fprint(&notes, display.theme.Paint(display.theme.Warning, tview.Escape(err.Error())))
+			} else {
+				fmt.Fprintf(&notes, "HTML report written to %s", tview.Escape(display.html))
+			}
+		}
+
+		// The view edits the results it shows, as pinging a host again does.
+		last := slices.Clone(results)
+		app.QueueUpdateDraw(func() {
+			scanResults = results
+			shownHeader, shownNotes = header.String(), notes.String()
+			if showResults != nil {
+				showResults(header.String(), notes.String())
+				return
+			}
+			var view tview.Primitive
+			view, showResults = newResultsView(app, analyzer, targets, &scanResults, display, header.String(), notes.String())
+			app.SetRoot(view, true)
+		})
+		return last, nil
+	}
+	if display.every > 0 {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		loop := rescanLoop{analyzer: analyzer, interval: display.every, onChange: onChange}
+		go func() {
+			loop.run(ctx, scan)
+			app.Stop()
+		}()
+	} else {
+		go scan(nil)
+	}
+
+	textView.SetBorder(true).SetTitle(tuiTitle)
+	err := app.SetRoot(textView, true).SetFocus(textView).Run()
+	if err != nil {
+		return nil, err
+	}
+
+	if scanErr == nil && scanMeta.Interrupted {
+		if !display.quiet {
+			fmt.Printf("%s in %s%s\n", summaryLine(Summarize(scanResults)), scanMeta.CIDR, deadlineNote(scanMeta))
+		}
+		if err := writeCompact(os.Stdout, scanResults, display); err != nil {
+			return scanResults, err
+		}
+	}
+	return scanResults, scanErr
+}
+
+// newResultsView lays out the outcome of a scan: header above the grid of
+// hosts, notes below it and a status line at the bottom. Pressing Enter on a
+// host pings it a few more times in a detail pane next to the grid and then
+// updates its entry in results, t traces the route to a used host in the same
+// pane. i shows everything known about the host in a popup. Escape closes the
+// popup or the pane. s switches between the sort orders.
+//
+// The returned show func puts a new header and notes around the grid and lays
+// out results again, keeping the selection and any open popup or pane.
+func newResultsView(app *tview.Application, analyzer *Analyzer, targets []string, results *[]Result, display displayOptions, header, notes string) (tview.Primitive, func(header, notes string)) {
+	table := tview.NewTable().SetSelectable(true, true)
+	sized := &resizingTable{Table: table}
+	footer := tview.NewTextView().SetTextAlign(tview.AlignRight)
+	detail := tview.NewTextView().SetDynamicColors(true)
+	detail.SetBorder(true)
+
+	grid := tview.NewFlex().
+		AddItem(sized, 0, 1, true).
+		AddItem(detail, 0, 0, false)
+
+	showPosition := func(row int) {
+		footer.SetText(fmt.Sprintf("row %d/%d by %s  Enter to ping again, i for details, t to trace the route, n to edit the note, s to sort ", row+1, table.GetRowCount(), display.sort))
+	}
+	table.SetSelectionChangedFunc(func(row, column int) {
+		showPosition(row)
+	})
+
+	cancelDetail := func() {}
+	table.SetDoneFunc(func(key tcell.Key) {
+		if key == tcell.KeyEscape {
+			cancelDetail()
+			grid.ResizeItem(detail, 0, 0)
+		}
+	})
+
+	// indexOf returns the index in results of the host with ip. With -every
+	// the results of a later scan may have replaced those a key was pressed
+	// on, so it is looked up again once a ping or a note is done.
+	indexOf := func(ip string) (int, bool) {
+		_, i, ok := lo.FindIndexOf(*results, func(r Result) bool { return r.IP.String() == ip })
+		return i, ok
+	}
+
+	// selected returns the index in results of the selected host.
+	selected := func() (int, bool) {
+		row, column := table.GetSelection()
+		ip, ok := table.GetCell(row, column).GetReference().(string)
+		if !ok {
+			return 0, false
+		}
+		return indexOf(ip)
+	}
+
+	// refill lays out the results again for the current width of the grid and
+	// keeps the same host selected, or the first one.
+	refill := func() {
+		row, column := table.GetSelection()
+		ip, _ := table.GetCell(row, column).GetReference().(string)
+
+		fillTable(table, targets, *results, display, sized.width)
+		found := false
+		for row := 0; row < table.GetRowCount() && !found; row++ {
+			for column := 0; column < table.GetColumnCount() && !found; column++ {
+				cell := table.GetCell(row, column)
+				if reference, ok := cell.GetReference().(string); ok && (reference == ip || ip == "") {
+					table.Select(row, column)
+					found = true
+				}
+			}
+		}
+		row, _ = table.GetSelection()
+		showPosition(row)
+	}
+
+	// openDetail shows the empty detail pane. The returned context is done
+	// once the pane is closed or reused.
+	openDetail := func(title string) context.Context {
+		cancelDetail()
+		ctx, cancel := context.WithCancel(context.Background())
+		cancelDetail = cancel
+
+		detail.Clear()
+		detail.SetTitle(" " + title + " ")
+		grid.ResizeItem(detail, detailWidth, 0)
+		return ctx
+	}
+
+	trace := func() {
+		i, ok := selected()
+		if !ok || !(*results)[i].Used {
+			return
+		}
+
+		ip := (*results)[i].IP
+		ctx := openDetail("route to " + ip.String())
+		go func() {
+			err := analyzer.Trace(ctx, ip, func(hop Hop) {
+				line := fmt.Sprintf("%2d  *", hop.TTL)
+				if hop.IP != nil {
+					line = fmt.Sprintf("%2d  %s  %s", hop.TTL, hop.IP, hop.RTT.Round(10*time.Microsecond))
+				}
+				app.QueueUpdateDraw(func() {
+					fmt.Fprintln(detail, line)
+				})
+			})
+			if err != nil && ctx.Err() == nil {
+				app.QueueUpdateDraw(func() {
+					fmt.Fprintln(detail, display.theme.Paint(display.theme.Warning, tview.Escape(err.Error())))
+				})
+			}
+		}()
+	}
+
+	pingAgain := func() {
+		i, ok := selected()
+		if !ok {
+			return
+		}
+		ctx := openDetail((*results)[i].IP.String())
+
+		previous := (*results)[i]
+		go func() {
+			var pings []PingResult
+			for seq := 1; seq <= detailPings; seq++ {
+				started := time.Now()
+				reply, err := analyzer.PingOnce(ctx, previous.IP)
+				if ctx.Err() != nil {
+					return
+				}
+
+				line := fmt.Sprintf("%d: %s", seq, display.theme.Paint(display.theme.Free, "no reply"))
+				if reply.Replied {
+					line = fmt.Sprintf("%d: %s", seq, display.theme.Paint(display.theme.Used, reply.RTT.Round(10*time.Microsecond).String()))
+					if reply.TTL > 0 {
+						line += fmt.Sprintf(" ttl %d", reply.TTL)
+					}
+				}
+				if err != nil {
+					line = fmt.Sprintf("%d: %s", seq, display.theme.Paint(display.theme.Warning, tview.Escape(err.Error())))
+				} else {
+					pings = append(pings, reply)
+				}
+				app.QueueUpdateDraw(func() {
+					fmt.Fprintln(detail, line)
+				})
+
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(detailInterval - time.Since(started)):
+				}
+			}
+
+			app.QueueUpdateDraw(func() {
+				i, ok := indexOf(previous.IP.String())
+				if !ok {
+					return
+				}
+				(*results)[i] = applyPings((*results)[i], pings)
+				replies := lo.CountBy(pings, func(p PingResult) bool { return p.Replied })
+				fmt.Fprintf(detail, "%d of %d answered: %s\n", replies, len(pings), display.theme.Status((*results)[i]))
+				if replies > 1 {
+					fmt.Fprintf(detail, "jitter %s\n", (*results)[i].Jitter.Round(10*time.Microsecond))
+				}
+				refill()
+			})
+		}()
+	}
+
+	pages := tview.NewPages()
+	showDetails := func() {
+		i, ok := selected()
+		if !ok {
+			return
+		}
+		text := hostDetails((*results)[i], analyzer.Method(), display.theme)
+		info := textLines(text)
+		info.SetBorder(true).SetTitle(" " + (*results)[i].IP.String() + " ")
+		info.SetDoneFunc(func(key tcell.Key) {
+			if key == tcell.KeyEscape {
+				pages.RemovePage("host")
+				app.SetFocus(table)
+			}
+		})
+		pages.AddPage("host", popup(info, hostDetailsWidth, strings.Count(text, "\n")+3), true, true)
+		app.SetFocus(info)
+	}
+	table.SetSelectedFunc(func(row, column int) {
+		pingAgain()
+	})
+
+	editNote := func() {
+		i, ok := selected()
+		if !ok {
+			return
+		}
+		ip := (*results)[i].IP
+		field := tview.NewInputField().SetText((*results)[i].Note)
+		field.SetBorder(true).SetTitle(" note on " + ip.String() + " ")
+		field.SetDoneFunc(func(key tcell.Key) {
+			pages.RemovePage("note")
+			app.SetFocus(table)
+			if key != tcell.KeyEnter {
+				return
+			}
+			note := strings.TrimSpace(field.GetText())
+			if err := analyzer.SetNote(ip, note); err != nil {
+				openDetail("note on " + ip.String())
+				fmt.Fprintln(detail, display.theme.Paint(display.theme.Warning, tview.Escape(err.Error())))
+				return
+			}
+			if i, ok := indexOf(ip.String()); ok {
+				(*results)[i].Note = note
+			}
+			refill()
+		})
+		pages.AddPage("note", popup(field, hostDetailsWidth, 3), true, true)
+		app.SetFocus(field)
+	}
+
+	table.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		switch event.Rune() {
+		case 't':
+			trace()
+		case 'n':
+			editNote()
+		case 'i':
+			showDetails()
+		case 's':
+			next := (lo.IndexOf(sortOrders, display.sort) + 1) % len(sortOrders)
+			display.sort = sortOrders[next]
+			refill()
+		default:
+			return event
+		}
+		return nil
+	})
+
+	sized.onResize = func(int) {
+		refill()
+		// The footer is drawn before the focused grid, so it needs another
+		// frame to show the new row count.
+		go app.Draw()
+	}
+
+	headerView, notesView := textLines(""), textLines("")
+	body := tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(headerView, 0, 0, false).
+		AddItem(grid, 0, 1, true).
+		AddItem(notesView, 0, 0, false)
+	body.SetBorder(true).SetTitle(tuiTitle)
+
+	show := func(header, notes string) {
+		headerView.SetText(header)
+		body.ResizeItem(headerView, strings.Count(header, "\n")+2, 0)
+		notesView.SetText("")
+		body.ResizeItem(notesView, 0, 0)
+		if notes != "" {
+			notesView.SetText("\n" + notes)
+			body.ResizeItem(notesView, strings.Count(notes, "\n")+2, 0)
+		}
+		refill()
+	}
+	show(header, notes)
+
+	layout := tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(body, 0, 1, true).
+		AddItem(footer, 1, 0, false)
+	return pages.AddPage("results", layout, true, true), show
+}
+
+// popup centers p in a box of the given size over the page below it.
+func popup(p tview.Primitive, width, height int) tview.Primitive {
+	return tview.NewFlex().
+		AddItem(nil, 0, 1, false).
+		AddItem(tview.NewFlex().SetDirection(tview.FlexRow).
+			AddItem(nil, 0, 1, false).
+			AddItem(p, height, 0, true).
+			AddItem(nil, 0, 1, false), width, 0, true).
+		AddItem(nil, 0, 1, false)
+}
+
+// hostDetails describes everything known about result, one field per line,
+// for the popup of the results view.
+func hostDetails(result Result, method string, theme Theme) string {
+	var b strings.Builder
+	field := func(name, value string) {
+		if value != "" {
+			fmt.Fprintf(&b, "%-13s %s\n", name+":", value)
+		}
+	}
+
+	status := theme.Paint(theme.StatusColor(result), theme.Status(result))
+	if result.Confidence > 0 && result.Confidence < 1 {
+		status += fmt.Sprintf(" (%.0f%% of probes answered)", result.Confidence*100)
+	}
+	field("Status", status)
+	field("Pools", strings.Join(result.Blocks, ", "))
+	if result.Used {
+		field("RTT", result.RTT.Round(10*time.Microsecond).String())
+	}
+	var samples []string
+	for _, rtt := range result.RTTs {
+		samples = append(samples, rtt.Round(10*time.Microsecond).String())
+	}
+	field("Samples", strings.Join(samples, " "))
+	if len(result.RTTs) > 1 {
+		field("Jitter", result.Jitter.Round(10*time.Microsecond).String())
+	}
+	if !result.Cached {
+		field("Packet loss", fmt.Sprintf("%.0f%%", (1-result.Confidence)*100))
+	}
+	field("Hostname", tview.Escape(result.Hostname))
+	field("Note", tview.Escape(result.Note))
+	for _, mac := range result.MACs {
+		field("MAC", mac.String())
+		field("Vendor", tview.Escape(macVendor(mac)))
+	}
+	if result.TTL > 0 {
+		field("TTL", fmt.Sprintf("%d (%s)", result.TTL, result.OSGuess()))
+	}
+	field("Lease", result.Lease)
+	field("SNMP name", tview.Escape(result.SNMP.Name))
+	field("SNMP descr", tview.Escape(truncate(result.SNMP.Descr, hostDetailsWidth-16)))
+	field("Ports", portMap(result))
+	for _, service := range result.Services {
+		field(fmt.Sprintf("TCP %d", service.Port), tview.Escape(truncate(service.Banner, hostDetailsWidth-16)))
+	}
+	field("Probed by", lo.If(result.Cached, "cached from an earlier scan").Else(method))
+	var answered []string
+	for _, m := range result.Methods {
+		if m == methodTCP && len(result.Services) == 0 {
+			m += " (every port refused)"
+		}
+		answered = append(answered, m)
+	}
+	field("Answered", strings.Join(answered, ", "))
+	for _, name := range interfaceNames([]Result{result}) {
+		field("On "+name, usedText(result.Interfaces[name]))
+	}
+	if result.Woke {
+		field("Woke up", "answered only after the warm-up")
+	}
+	if result.Err != nil {
+		field("Error", theme.Paint(theme.Warning, result.ErrorClass()+": "+tview.Escape(result.Err.Error())))
+	}
+	b.WriteString("\nEscape to close")
+	return b.String()
+}
+
+// applyPings returns result updated from the pings of the detail pane. Details
+// such as the hostname are kept.
+func applyPings(result Result, pings []PingResult) Result {
+	if len(pings) == 0 {
+		return result
+	}
+
+	var (
+		replies int
+		total   time.Duration
+		ttl     int
+		rtts    []time.Duration
+	)
+	for _, p := range pings {
+		if p.Replied {
+			replies++
+			total += p.RTT
+			ttl = max(ttl, p.TTL)
+			rtts = append(rtts, p.RTT)
+		}
+	}
+
+	result.Used = replies > 0
+	result.RTT = 0
+	if replies > 0 {
+		result.RTT = total / time.Duration(replies)
+	}
+	result.TTL = ttl
+	result.RTTs = rtts
+	result.Jitter = jitter(rtts)
+	result.Confidence = float64(replies) / float64(len(pings))
+	result.Err = nil
+	return result
+}
+
+func textLines(text string) *tview.TextView {
+	return tview.NewTextView().SetDynamicColors(true).SetWrap(false).SetText(text)
+}
+
+// fillTable puts the results into table, as many hosts per row as fit into
+// width but at most numColumns, in sections per pool or per address family
+// like the rest of the output. A width of 0 means unknown.
+func fillTable(table *tview.Table, targets []string, results []Result, display displayOptions, width int) {
+	table.Clear()
+
+	type section struct {
+		title, summary string
+		results        []Result
+		cells          []string
+	}
+	var sections []section
+	add := func(title, summary string, results []Result) {
+		sections = append(sections, section{title, summary, results, gridCells(results, display.theme)})
+	}
+
+	shown := visibleResults(results, display)
+	v4, v6 := splitFamilies(shown)
+	if display.grouped(targets) {
+		groups := groupByBlock(results)
+		for _, block := range canonicalBlocks(targets) {
+			add(block, summaryLine(Summarize(groups[block])), visibleResults(groups[block], display))
+		}
+	} else if len(v4) > 0 && len(v6) > 0 {
+		add("IPv4", "", v4)
+		add("IPv6", "", v6)
+	} else {
+		add("", "", shown)
+	}
+
+	columns := numColumns
+	if width > 0 {
+		cellWidth := 1
+		for _, s := range sections {
+			for _, text := range s.cells {
+				cellWidth = max(cellWidth, tview.TaggedStringWidth(text))
+			}
+		}
+		// The table puts a separator between columns.
+		columns = min(max((width+1)/(cellWidth+1), 1), numColumns)
+	}
+
+	row := 0
+	for _, s := range sections {
+		if row > 0 {
+			row++
+		}
+		if s.title != "" {
+			table.SetCell(row, 0, tview.NewTableCell(s.title).SetSelectable(false))
+			if s.summary != "" {
+				table.SetCell(row, 1, tview.NewTableCell(s.summary).SetSelectable(false))
+			}
+			row += 2
+		}
+		for i, text := range s.cells {
+			cell := tview.NewTableCell(text).SetReference(s.results[i].IP.String())
+			table.SetCell(row+i/columns, i%columns, cell)
+		}
+		row += (len(s.cells) + columns - 1) / columns
+	}
+}
+
+// resizingTable is a table that calls onResize before it is drawn at a new
+// width, so the grid can be laid out again when the terminal is resized.
+type resizingTable struct {
+	*tview.Table
+	width    int
+	onResize func(width int)
+}
+
+func (t *resizingTable) Draw(screen tcell.Screen) {
+	if _, _, width, _ := t.GetInnerRect(); width != t.width {
+		t.width = width
+		if t.onResize != nil {
+			t.onResize(width)
+		}
+	}
+	t.Table.Draw(screen)
+}
+
+func writeSubnetInfo(w io.Writer, info SubnetInfo) {
+	if info.Broadcast != nil {
+		fmt.Fprintf(w, "  Network %s/%d, netmask %s, broadcast %s\n", info.Network, info.Prefix, info.Netmask, info.Broadcast)
+	} else {
+		fmt.Fprintf(w, "  Network %s/%d\n", info.Network, info.Prefix)
+	}
+	if info.Hosts > 0 {
+		fmt.Fprintf(w, "  Hosts %s - %s (%d usable)\n", info.FirstHost, info.LastHost, info.Hosts)
+	}
+}
+
+// gridCells returns the text of a grid cell for every result, each part
+// padded to the widest one so that the parts line up between rows.
+func gridCells(results []Result, theme Theme) []string {
+	type cell struct {
+		ip, status, name, note, mac, lease, os string
+		color                                  string
+	}
+
+	var (
+		cells  []cell
+		widths [7]int
+	)
+	for _, result := range results {
+		status := theme.Status(result)
+		if result.Used && result.Confidence < 1 {
+			// Marginal hosts lost some probes: show how many were answered.
+			status += fmt.Sprintf(" %d%%", int(result.Confidence*100))
+		}
+		if result.Changed {
+			status += " (was " + usedText(!result.Used) + ")"
+		}
+		if result.Mismatch() {
+			status += " on " + strings.Join(answeredOn(result), ",")
+		}
+		c := cell{
+			ip:     result.IP.String(),
+			status: status,
+			lease:  result.Lease,
+			os:     result.OSGuess(),
+			name:   truncate(result.Hostname, maxNameWidth),
+			note:   truncate(result.Note, maxNameWidth),
+			color:  theme.StatusColor(result),
+		}
+		var macs []string
+		for _, mac := range result.MACs {
+			macs = append(macs, mac.String())
+		}
+		c.mac = strings.Join(macs, ",")
+
+		widths[0] = max(widths[0], len(c.ip))
+		widths[1] = max(widths[1], tview.TaggedStringWidth(c.status))
+		widths[2] = max(widths[2], utf8.RuneCountInString(c.name))
+		widths[3] = max(widths[3], len(c.mac))
+		widths[4] = max(widths[4], len(c.lease))
+		widths[5] = max(widths[5], len(c.os))
+		widths[6] = max(widths[6], utf8.RuneCountInString(c.note))
+		cells = append(cells, c)
+	}
+
+	texts := make([]string, len(cells))
+	for i, c := range cells {
+		var b strings.Builder
+		fmt.Fprintf(&b, "%-*s - %s", widths[0], c.ip, theme.Paint(c.color, c.status+strings.Repeat(" ", widths[1]-tview.TaggedStringWidth(c.status))))
+		if widths[2] > 0 {
+			fmt.Fprintf(&b, " %s%s", tview.Escape(c.name), strings.Repeat(" ", widths[2]-utf8.RuneCountInString(c.name)))
+		}
+		if widths[6] > 0 {
+			fmt.Fprintf(&b, " %s%s", tview.Escape(c.note), strings.Repeat(" ", widths[6]-utf8.RuneCountInString(c.note)))
+		}
+		if widths[3] > 0 {
+			fmt.Fprintf(&b, " %-*s", widths[3], c.mac)
+		}
+		if widths[4] > 0 {
+			fmt.Fprintf(&b, " %-*s", widths[4], c.lease)
+		}
+		if widths[5] > 0 {
+			fmt.Fprintf(&b, " %-*s", widths[5], c.os)
+		}
+		b.WriteString(columnSeparator[1:])
+		texts[i] = b.String()
+	}
+	return texts
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/binary"
+	"errors"
+	"math/rand"
+	"net"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/go-ping/ping"
+)
+
+// udpProbes holds payloads for services that ignore empty datagrams, together
+// with a check that the answer is a reply to it.
+var udpProbes = map[int]struct {
+	payload func(opts Options) []byte
+	valid   func(request, reply []byte) bool
+}{
+	53: {
+		payload: func(Options) []byte { return dnsQuery() },
+		valid: func(request, reply []byte) bool {
+			// Same ID and the QR bit set.
+			return len(reply) >= 12 && bytes.Equal(reply[:2], request[:2]) && reply[2]&0x80 != 0
+		},
+	},
+	161: {
+		payload: func(opts Options) []byte {
+			community := cmp.Or(opts.SNMPCommunity, defaultSNMPCommunity)
+			return snmpGetRequest(community, rand.Int31(), oidSysUpTime)
+		},
+		valid: func(request, reply []byte) bool {
+			return len(reply) > 0 && reply[0] == 0x30
+		},
+	},
+}
+
+// dnsQuery builds a query for the NS records of the root zone.
+func dnsQuery() []byte {
+	query := make([]byte, 12, 17)
+	binary.BigEndian.PutUint16(query[0:], uint16(rand.Intn(1<<16)))
+	binary.BigEndian.PutUint16(query[2:], 0x0100) // recursion desired
+	binary.BigEndian.PutUint16(query[4:], 1)      // one question
+	return append(query, 0x00, 0x00, 0x02, 0x00, 0x01)
+}
+
+// udpPinger marks a host as used when a service answers on the port, or the
+// host tells that the port is closed with an ICMP port unreachable. Hosts and
+// firewalls silently drop UDP, so a missing reply does not prove the address
+// is free: this is best effort.
+type udpPinger struct {
+	opts Options
+}
+
+func newUDPPinger(opts Options) *udpPinger {
+	return &udpPinger{opts: opts}
+}
+
+func (p *udpPinger) Ping(ctx context.Context, address net.IP, onRecv func(*ping.Packet)) (*ping.Statistics, error) {
+	deadline := time.Now().Add(p.opts.Timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+
+	addr := net.JoinHostPort(address.String(), strconv.Itoa(p.opts.UDPPort))
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	stop := context.AfterFunc(ctx, func() { conn.SetDeadline(time.Now()) })
+	defer stop()
+
+	ipAddr := &net.IPAddr{IP: address}
+	stats := &ping.Statistics{IPAddr: ipAddr, Addr: address.String()}
+	reply := make([]byte, 1500)
+
+	attempts := max(p.opts.Count, 1)
+	for attempt := 0; attempt < attempts && ctx.Err() == nil; attempt++ {
+		request := []byte{}
+		probe, known := udpProbes[p.opts.UDPPort]
+		if known {
+			request = probe.payload(p.opts)
+		}
+
+		attemptDeadline := time.Now().Add(time.Until(deadline) / time.Duration(attempts-attempt))
+		conn.SetDeadline(attemptDeadline)
+
+		sent := time.Now()
+		if _, err := conn.Write(request); err != nil && !errors.Is(err, syscall.ECONNREFUSED) {
+			return nil, err
+		}
+		stats.PacketsSent++
+
+		for {
+			n, err := conn.Read(reply)
+			// Only a live host sends the ICMP port unreachable behind
+			// ECONNREFUSED.
+			refused := errors.Is(err, syscall.ECONNREFUSED)
+			if err != nil && !refused {
+				break
+			}
+			if !refused && known && !probe.valid(request, reply[:n]) {
+				continue
+			}
+
+			rtt := time.Since(sent)
+			stats.PacketsRecv++
+			stats.Rtts = append(stats.Rtts, rtt)
+			if onRecv != nil {
+				onRecv(&ping.Packet{Rtt: rtt, IPAddr: ipAddr, Addr: address.String(), Nbytes: n, Seq: attempt})
+			}
+			break
+		}
+		if stats.PacketsRecv > 0 {
+			break
+		}
+	}
+
+	summarizeStats(stats)
+
+	logger.Debug("udp probe finished",
+		"ip", address,
+		"port", p.opts.UDPPort,
+		"sent", stats.PacketsSent,
+		"recv", stats.PacketsRecv)
+
+	return stats, nil
+}
+
+// bytesSent counts datagrams with the payload of the port, empty for ports
+// without a known service.
+func (p *udpPinger) bytesSent(ip net.IP, stats *ping.Statistics) int {
+	const udpHeader = 8
+	var payload int
+	if probe, known := udpProbes[p.opts.UDPPort]; known {
+		payload = len(probe.payload(p.opts))
+	}
+	return stats.PacketsSent * (ipHeaderLen(ip) + udpHeader + payload)
+}
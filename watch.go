@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// statusChange is a host that went from used to free or back between two
+// scans of watch mode.
+type statusChange struct {
+	IP   string    `json:"ip"`
+	Old  string    `json:"old_status"`
+	New  string    `json:"new_status"`
+	Time time.Time `json:"timestamp"`
+}
+
+// runWatch scans targets every interval until the process is interrupted and
+// writes a line to w for every host whose status changed since the scan
+// before. onChange, when set, is called for every change as well. When stdin
+// is a terminal, pressing Enter writes the state of every host as of the last
+// scan in between. Ctrl-C during a scan stops it and writes the changes found
+// so far, or the state of every host if it was the first scan.
+func runWatch(w io.Writer, analyzer *Analyzer, targets []string, interval time.Duration, display displayOptions, onChange func(statusChange)) ([]Result, error) {
+	var lastScan time.Time
+	showState := func(results []Result) error {
+		fmt.Fprintf(w, "State at %s: %s\n", lastScan.Format(time.RFC3339), summaryLine(Summarize(results)))
+		return writeCompact(w, results, display)
+	}
+
+	loop := rescanLoop{
+		analyzer: analyzer,
+		interval: interval,
+		onChange: func(change statusChange) {
+			fmt.Fprintf(w, "%s %s %s -> %s\n", change.Time.Format(time.RFC3339), change.IP, change.Old, change.New)
+			if onChange != nil {
+				onChange(change)
+			}
+		},
+		show: showState,
+	}
+	if isTerminal(os.Stdin) {
+		showAll := make(chan struct{}, 1)
+		go readEnter(os.Stdin, showAll)
+		loop.showAll = showAll
+	}
+
+	return loop.run(context.Background(), func(previous []Result) ([]Result, error) {
+		defer stopOnInterrupt(analyzer, display)()
+		results, meta, err := analyzer.Scan(targets)
+		lastScan = meta.Finished
+		if err != nil || previous != nil {
+			return results, err
+		}
+		if analyzer.Stopped() {
+			// There are no changes yet to show for the scan so far.
+			return results, showState(results)
+		}
+		if !display.quiet {
+			fmt.Fprintf(os.Stderr, "Watching %s every %s: %s\n", meta.CIDR, interval, summaryLine(Summarize(results)))
+			if isTerminal(os.Stdin) {
+				fmt.Fprintln(os.Stderr, "Only changes are shown; press Enter to see every IP")
+			}
+		}
+		return results, nil
+	})
+}
+
+// readEnter signals on enter every time a line is read from r, until r ends.
+func readEnter(r io.Reader, enter chan<- struct{}) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		select {
+		case enter <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func usedText(used bool) string {
+	if used {
+		return "used"
+	}
+	return "free"
+}
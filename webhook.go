@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+const (
+	webhookAttempts = 3
+	webhookBackoff  = time.Second
+	webhookTimeout  = 10 * time.Second
+	webhookQueue    = 256
+)
+
+// webhook POSTs every status change of watch mode as JSON to a URL. Changes are
+// delivered in order by a single goroutine, so a slow endpoint never holds up
+// the scans. Failed deliveries are retried a few times and then logged.
+type webhook struct {
+	url    string
+	client *http.Client
+	queue  chan statusChange
+	done   chan struct{}
+}
+
+func newWebhook(url string) *webhook {
+	h := &webhook{
+		url:    url,
+		client: &http.Client{Timeout: webhookTimeout},
+		queue:  make(chan statusChange, webhookQueue),
+		done:   make(chan struct{}),
+	}
+	go h.run()
+	return h
+}
+
+// Notify queues change for delivery. It drops the change when too many are
+// waiting already.
+func (h *webhook) Notify(change statusChange) {
+	select {
+	case h.queue <- change:
+	default:
+		logger.Error("webhook queue is full, dropping change", "ip", change.IP)
+	}
+}
+
+// Close delivers the changes that are still queued.
+func (h *webhook) Close() {
+	close(h.queue)
+	<-h.done
+}
+
+func (h *webhook) run() {
+	defer close(h.done)
+	for change := range h.queue {
+		body, err := json.Marshal(change)
+		if err != nil {
+			logger.Error("encoding webhook payload failed", "ip", change.IP, "err", err)
+			continue
+		}
+
+		backoff := webhookBackoff
+		for attempt := 1; ; attempt++ {
+			err = h.post(body)
+			if err == nil {
+				break
+			}
+			if attempt == webhookAttempts {
+				logger.Error("delivering webhook failed", "ip", change.IP, "attempts", attempt, "err", err)
+				break
+			}
+			logger.Warn("delivering webhook failed, retrying", "ip", change.IP, "attempt", attempt, "err", err)
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+	}
+}
+
+func (h *webhook) post(body []byte) error {
+	resp, err := h.client.Post(h.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("Unexpected status %s", resp.Status)
+	}
+	return nil
+}